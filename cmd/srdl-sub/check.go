@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Finding is a problem found when checking the config and subscriptions.
+type Finding struct {
+	// Path is the path to the offending value, such as
+	// "presets.jellyfin.output".
+	Path string
+	// Message describes the problem.
+	Message string
+}
+
+func (f Finding) String() string {
+	return f.Path + ": " + f.Message
+}
+
+// check is the entrypoint of the "check" command.
+func check(args []string) error {
+	commandLine := flag.NewFlagSet(os.Args[0]+" check", flag.ExitOnError)
+
+	configFilePath := commandLine.String("config", "", "Config file path")
+	subscriptionsFilePath := commandLine.String("subscriptions", "", "Subscriptions file path")
+	commandLine.Parse(args)
+
+	if *configFilePath == "" || *subscriptionsFilePath == "" {
+		commandLine.Usage()
+		os.Exit(1)
+	}
+
+	var config Config
+	if err := readYamlFromFile(*configFilePath, &config); err != nil {
+		return err
+	}
+
+	var subscriptions map[string]Subscription
+	if err := readYamlFromFile(*subscriptionsFilePath, &subscriptions); err != nil {
+		return err
+	}
+
+	findings := checkConfig(config, subscriptions)
+	printFindings(os.Stdout, findings)
+	if len(findings) > 0 {
+		return fmt.Errorf("found %d problems", len(findings))
+	}
+
+	return nil
+}
+
+// printFindings writes findings to w, one per line.
+func printFindings(w io.Writer, findings []Finding) {
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "No problems found")
+		return
+	}
+
+	for _, finding := range findings {
+		fmt.Fprintln(w, finding)
+	}
+}
+
+// checkConfig validates config and subscriptions, returning all problems
+// found sorted by path.
+func checkConfig(config Config, subscriptions map[string]Subscription) []Finding {
+	findings := make([]Finding, 0)
+	report := func(path string, format string, args ...any) {
+		findings = append(findings, Finding{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if _, err := config.SlogLogLevel(); err != nil {
+		report("logLevel", "invalid log level %q, expected debug, info, warn or error", config.LogLevel)
+	}
+
+	checkDuration(report, "cache.ttl", config.Cache.TTL)
+	if config.Cache.Directory != "" {
+		if err := checkDirectory(config.Cache.Directory); err != nil {
+			report("cache.directory", "%v", err)
+		}
+	}
+
+	if config.State != "" {
+		if err := checkDirectory(filepath.Dir(config.State)); err != nil {
+			report("state", "%v", err)
+		}
+	}
+
+	if config.Notifiers.Audiobookshelf.URL != "" && len(config.Notifiers.Audiobookshelf.Libraries) == 0 {
+		report("notifiers.audiobookshelf.libraries", "no libraries to scan")
+	}
+
+	checkTemplate(report, "output", config.Output)
+
+	for name, preset := range config.Presets {
+		path := "presets." + name
+		checkTemplate(report, path+".output", preset.Output)
+		checkDuration(report, path+".downloadRange", preset.DownloadRange)
+		checkDuration(report, path+".retention", preset.Retention)
+		checkDuration(report, path+".throttling.perDownload", preset.Throttling.DownloadDelay)
+		checkDuration(report, path+".throttling.perEpisode", preset.Throttling.EpisodeDelay)
+		checkDuration(report, path+".throttling.perSubscription", preset.Throttling.SubscriptionDelay)
+		checkDuration(report, path+".images.refreshInterval", preset.Images.RefreshInterval)
+		if preset.Throttling.MaxDownloadsPerProgram < 0 {
+			report(path+".throttling.maxDownloadsPerProgram", "must not be negative")
+		}
+
+		for i, hook := range preset.Hooks {
+			hookPath := path + ".hooks[" + strconv.Itoa(i) + "]"
+			checkDuration(report, hookPath+".timeout", hook.Timeout)
+			if len(hook.Command) == 0 && hook.URL == "" {
+				report(hookPath, "neither command nor url is set")
+			}
+			for _, event := range hook.Events {
+				if !slices.Contains([]HookEvent{HookEventDownloaded, HookEventFailed, HookEventRemoved}, event) {
+					report(hookPath+".events", "unknown event %q, expected downloaded, failed or removed", event)
+				}
+			}
+		}
+	}
+
+	// Resolve the output path of each subscription to find collisions
+	outputPaths := make(map[string][]string)
+	for id, subscription := range subscriptions {
+		path := "subscriptions." + id
+		identifiers := 0
+		for _, set := range []bool{subscription.ProgramID != 0, subscription.URL != "", subscription.Slug != "", subscription.Programs != nil} {
+			if set {
+				identifiers++
+			}
+		}
+		if identifiers == 0 {
+			report(path, "one of programId, url, slug or programs must be set")
+		} else if identifiers > 1 {
+			report(path, "only one of programId, url, slug or programs may be set")
+		}
+
+		if selector := subscription.Programs; selector != nil {
+			if selector.ChannelID == 0 && selector.CategoryID == 0 && selector.NamePattern == "" {
+				report(path+".programs", "one of channelId, categoryId or namePattern must be set")
+			}
+
+			if _, err := regexp.Compile(selector.NamePattern); err != nil {
+				report(path+".programs.namePattern", "invalid pattern: %v", err)
+			}
+		}
+
+		if subscription.ProgramID < 0 {
+			report(path+".programId", "must be a positive program id")
+		}
+
+		if subscription.URL != "" {
+			if u, err := url.Parse(subscription.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				report(path+".url", "invalid url %q", subscription.URL)
+			}
+		}
+
+		appliedConfig := Preset{Output: config.Output}
+		for _, presetName := range subscription.Presets {
+			preset, ok := config.Presets[presetName]
+			if !ok {
+				report(path+".presets", "unknown preset %q", presetName)
+				continue
+			}
+
+			appliedConfig = appliedConfig.Apply(preset)
+		}
+
+		// The program's name is unknown without calling SR's API, so use a
+		// placeholder that is unique per program
+		program := strconv.Itoa(subscription.ProgramID)
+		if subscription.ProgramID == 0 {
+			program = strings.ReplaceAll(subscription.ProgramPageURL(), "/", "_")
+		}
+		values := TemplateValues{
+			Subscription: SubscriptionTemplateValues{
+				Artist: subscription.Artist,
+				Album:  subscription.Album,
+			},
+			Program: ProgramTemplateValues{
+				Name: "program " + program,
+			},
+		}
+		outputPath, err := renderOutputPathTemplate(appliedConfig.Output, values)
+		if err != nil {
+			// Template errors are reported for the preset
+			continue
+		}
+
+		if hasEmptySegment(outputPath) {
+			report(path, "output path %q has an empty directory name, is artist or album missing?", outputPath)
+		}
+
+		// Each selected program is output to its own directory, named after the
+		// program unless the template uses the program's name
+		if subscription.Programs != nil {
+			if isSharedOutputPathTemplate(appliedConfig.Output, values) {
+				report(path, "output path %q is shared by all selected programs, which are output to subdirectories named after them, use {{.Program.Name}} in the output template to choose where", outputPath)
+			}
+
+			if err := checkDirectory(outputPath); err != nil {
+				report(path, "output path %q is unreachable: %v", outputPath, err)
+			}
+			continue
+		}
+
+		if outputPath == "" {
+			outputPath = "."
+		}
+		outputPath = filepath.Clean(outputPath)
+		outputPaths[outputPath] = append(outputPaths[outputPath], id)
+
+		if err := checkDirectory(outputPath); err != nil {
+			report(path, "output path %q is unreachable: %v", outputPath, err)
+		}
+	}
+
+	for outputPath, ids := range outputPaths {
+		if len(ids) < 2 {
+			continue
+		}
+
+		slices.Sort(ids)
+		for _, id := range ids {
+			others := slices.DeleteFunc(slices.Clone(ids), func(other string) bool { return other == id })
+			report("subscriptions."+id, "output path %q is shared with %s, files such as cover images will collide", outputPath, strings.Join(others, ", "))
+		}
+	}
+
+	slices.SortFunc(findings, func(a Finding, b Finding) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Message, b.Message)
+	})
+
+	return findings
+}
+
+// checkDuration reports negative durations.
+func checkDuration(report func(path string, format string, args ...any), path string, duration time.Duration) {
+	if duration < 0 {
+		report(path, "must not be negative, got %s", duration)
+	}
+}
+
+// checkTemplate reports output path templates that fail to parse or render
+// using sample data, or that are likely to be unintentionally literal.
+func checkTemplate(report func(path string, format string, args ...any), path string, template string) {
+	rendered, err := renderOutputPathTemplate(template, TemplateValues{
+		Subscription: SubscriptionTemplateValues{
+			Artist: "Artist",
+			Album:  "Album",
+		},
+		Program: ProgramTemplateValues{
+			Name: "Program",
+		},
+	})
+	if err != nil {
+		report(path, "invalid template: %v", err)
+		return
+	}
+
+	// Such as "{.Program.Name}" instead of "{{.Program.Name}}"
+	if strings.ContainsAny(rendered, "{}") {
+		report(path, "rendered path %q contains braces, is the template missing braces?", rendered)
+	}
+}
+
+// hasEmptySegment returns whether or not path contains empty directory
+// names, such as "output//Album".
+func hasEmptySegment(path string) bool {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for i, segment := range segments {
+		// Allow leading and trailing slashes
+		if segment == "" && i > 0 && i < len(segments)-1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkDirectory returns an error if the directory at path cannot be created
+// or written to. The nearest existing ancestor of path must be a writable
+// directory.
+func checkDirectory(path string) error {
+	path = filepath.Clean(path)
+	for {
+		stat, err := os.Stat(path)
+		if err == nil {
+			if !stat.IsDir() {
+				return fmt.Errorf("%s is not a directory", path)
+			}
+			break
+		} else if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, syscall.ENOTDIR) {
+			return err
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return err
+		}
+		path = parent
+	}
+
+	// The only reliable way to know if a directory is writable is to write to it
+	file, err := os.CreateTemp(path, ".srdl-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable", path)
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConfig(t *testing.T) {
+	output := t.TempDir()
+
+	file := filepath.Join(output, "file")
+	require.NoError(t, os.WriteFile(file, []byte{}, 0644))
+
+	config := Config{
+		Output:   output + "/{{.Program.Name}}",
+		LogLevel: "verbose",
+		Presets: map[string]Preset{
+			"jellyfin": {
+				Output: output + "/{.Subscription.Artist}/{.Subscription.Album}",
+			},
+			"invalid": {
+				Output:    output + "/{{.Program.Name",
+				Retention: -time.Hour,
+				Hooks: []Hook{
+					{Events: []HookEvent{"added"}},
+				},
+			},
+			"unknownField": {
+				Output: "{{.Program.Title}}",
+			},
+			"artist": {
+				Output: output + "/{{.Subscription.Artist}}/{{.Subscription.Album}}",
+			},
+			"file": {
+				Output: file + "/{{.Program.Name}}",
+			},
+		},
+	}
+
+	subscriptions := map[string]Subscription{
+		"textochmusik": {
+			ProgramID: 4914,
+			Presets:   []string{"missing"},
+		},
+		"textochmusik2": {
+			ProgramID: 4914,
+		},
+		"retro": {
+			ProgramID: 3260,
+			Album:     "P4 Retro",
+			Presets:   []string{"artist"},
+		},
+		"musikprofessorn": {
+			ProgramID: 5082,
+			Presets:   []string{"file"},
+		},
+		"ambiguous": {
+			ProgramID: 5082,
+			Slug:      "musikprofessorn",
+			Presets:   []string{"artist"},
+		},
+		"missing": {
+			URL:     "sverigesradio.se/musikprofessorn",
+			Presets: []string{"artist"},
+		},
+		"p2": {
+			Programs: &ProgramSelector{ChannelID: 163, NamePattern: "(musik"},
+			Artist:   "Artist",
+			Album:    "Album",
+			Presets:  []string{"artist"},
+		},
+	}
+
+	expected := []Finding{
+		{Path: "logLevel", Message: `invalid log level "verbose", expected debug, info, warn or error`},
+		{Path: "presets.invalid.hooks[0]", Message: "neither command nor url is set"},
+		{Path: "presets.invalid.hooks[0].events", Message: `unknown event "added", expected downloaded, failed or removed`},
+		{Path: "presets.invalid.output", Message: "invalid template: template: :1: unclosed action"},
+		{Path: "presets.invalid.retention", Message: "must not be negative, got -1h0m0s"},
+		{Path: "presets.jellyfin.output", Message: `rendered path "` + output + `/{.Subscription.Artist}/{.Subscription.Album}" contains braces, is the template missing braces?`},
+		{Path: "presets.unknownField.output", Message: `invalid template: template: :1:10: executing "" at <.Program.Title>: can't evaluate field Title in type main.ProgramTemplateValues`},
+		{Path: "subscriptions.ambiguous", Message: "only one of programId, url, slug or programs may be set"},
+		{Path: "subscriptions.ambiguous", Message: `output path "` + output + `" is shared with missing, files such as cover images will collide`},
+		{Path: "subscriptions.ambiguous", Message: `output path "` + output + `//" has an empty directory name, is artist or album missing?`},
+		{Path: "subscriptions.missing", Message: `output path "` + output + `" is shared with ambiguous, files such as cover images will collide`},
+		{Path: "subscriptions.missing", Message: `output path "` + output + `//" has an empty directory name, is artist or album missing?`},
+		{Path: "subscriptions.missing.url", Message: `invalid url "sverigesradio.se/musikprofessorn"`},
+		{Path: "subscriptions.musikprofessorn", Message: `output path "` + file + `/program 5082" is unreachable: ` + file + ` is not a directory`},
+		{Path: "subscriptions.p2", Message: `output path "` + output + `/Artist/Album" is shared by all selected programs, which are output to subdirectories named after them, use {{.Program.Name}} in the output template to choose where`},
+		{Path: "subscriptions.p2.programs.namePattern", Message: "invalid pattern: error parsing regexp: missing closing ): `(musik`"},
+		{Path: "subscriptions.retro", Message: `output path "` + output + `//P4 Retro" has an empty directory name, is artist or album missing?`},
+		{Path: "subscriptions.textochmusik", Message: `output path "` + output + `/program 4914" is shared with textochmusik2, files such as cover images will collide`},
+		{Path: "subscriptions.textochmusik.presets", Message: `unknown preset "missing"`},
+		{Path: "subscriptions.textochmusik2", Message: `output path "` + output + `/program 4914" is shared with textochmusik, files such as cover images will collide`},
+	}
+
+	assert.Equal(t, expected, checkConfig(config, subscriptions))
+}
+
+func TestCheckConfigExamples(t *testing.T) {
+	var config Config
+	require.NoError(t, readYamlFromFile("../../examples/config.yaml", &config))
+
+	var subscriptions map[string]Subscription
+	require.NoError(t, readYamlFromFile("../../examples/subscriptions.yaml", &subscriptions))
+
+	// Don't depend on the working directory being writable
+	config.Output = t.TempDir()
+	for name, preset := range config.Presets {
+		if preset.Output != "" {
+			preset.Output = filepath.Join(config.Output, preset.Output)
+			config.Presets[name] = preset
+		}
+	}
+	config.Cache.Directory = ""
+
+	assert.Empty(t, checkConfig(config, subscriptions))
+}
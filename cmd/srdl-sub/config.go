@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/goccy/go-yaml"
@@ -19,6 +20,26 @@ type Config struct {
 	LogLevel string `yaml:"logLevel"`
 	// Presets maps presets by a unique id.
 	Presets map[string]Preset `yaml:"presets"`
+	// Cache contains configuration of the on-disk HTTP cache.
+	Cache Cache `yaml:"cache"`
+	// State is the path to the file where downloaded episodes are recorded.
+	// Recorded episodes are never downloaded again, even if their files have
+	// been moved or renamed. Unless set, episodes are only identified as
+	// downloaded by their files.
+	State string `yaml:"state"`
+	// Notifiers contains configuration of media servers to notify after a run
+	// that downloaded episodes.
+	Notifiers Notifiers `yaml:"notifiers"`
+}
+
+// Cache contains configuration of the on-disk HTTP cache.
+type Cache struct {
+	// Directory is the path to the directory where responses are cached.
+	// Caching is disabled unless set.
+	Directory string `yaml:"directory"`
+	// TTL is the time responses such as program and episode metadata are
+	// considered fresh, unless SR specifies otherwise.
+	TTL time.Duration `yaml:"ttl"`
 }
 
 // SlogLogLevel returns the [slog.Level] that maps to the configured log level.
@@ -54,6 +75,11 @@ type Preset struct {
 	Retention time.Duration `yaml:"retention"`
 	// Throttling contains throttling configuration.
 	Throttling Throttling `yaml:"throttling"`
+	// Images contains configuration of downloaded images.
+	Images Images `yaml:"images"`
+	// Hooks are run when episodes are downloaded, fail to download or are
+	// removed.
+	Hooks []Hook `yaml:"hooks"`
 }
 
 // Apply returns a preset that is described by p and overridden by other.
@@ -71,6 +97,10 @@ func (p Preset) Apply(other Preset) Preset {
 	}
 
 	p.Throttling = p.Throttling.Apply(other.Throttling)
+	p.Images = p.Images.Apply(other.Images)
+
+	// Hooks are additive, so that presets can be combined
+	p.Hooks = append(slices.Clip(p.Hooks), other.Hooks...)
 
 	return p
 }
@@ -109,19 +139,79 @@ func (t Throttling) Apply(other Throttling) Throttling {
 	return t
 }
 
+// Images contains configuration of downloaded images.
+type Images struct {
+	// RefreshInterval is the minimum time between checks for whether downloaded
+	// images have changed. Images are never refreshed unless set.
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+	// CoverPreset is the SR image preset to use for cover images, such as
+	// "api-default-square" or "2048x2048".
+	CoverPreset string `yaml:"coverPreset"`
+	// BackdropPreset is the SR image preset to use for backdrop images, such as
+	// "api-default-rectangle" or "2048x1152".
+	BackdropPreset string `yaml:"backdropPreset"`
+	// EpisodePreset is the SR image preset to use for episode images.
+	EpisodePreset string `yaml:"episodePreset"`
+}
+
+// Apply returns images configuration that is described by i and overridden
+// by other.
+func (i Images) Apply(other Images) Images {
+	if other.RefreshInterval > 0 {
+		i.RefreshInterval = other.RefreshInterval
+	}
+
+	if other.CoverPreset != "" {
+		i.CoverPreset = other.CoverPreset
+	}
+
+	if other.BackdropPreset != "" {
+		i.BackdropPreset = other.BackdropPreset
+	}
+
+	if other.EpisodePreset != "" {
+		i.EpisodePreset = other.EpisodePreset
+	}
+
+	return i
+}
+
 // Subscription contains configuration for the subscription of a specific
 // program.
 type Subscription struct {
 	// ProgramID is the unique id of the program to subscribe to.
-	ProgramID int `yaml:"programId"`
+	// Either ProgramID, URL or Slug must be set.
+	ProgramID int `yaml:"programId,omitempty"`
+	// URL is the URL of the page of the program to subscribe to, such as
+	// "https://www.sverigesradio.se/textochmusikmedericschuldt".
+	URL string `yaml:"url,omitempty"`
+	// Slug is the name of the program to subscribe to as used in the URL of its
+	// page, such as "textochmusikmedericschuldt".
+	Slug string `yaml:"slug,omitempty"`
+	// Programs selects multiple programs to subscribe to, such as all programs
+	// of a channel. Each program is processed like a separate subscription.
+	Programs *ProgramSelector `yaml:"programs,omitempty"`
 	// Artist is the name of the "artist" directory that is created in the
 	// designated output directory.
-	Artist string `yaml:"artist"`
+	Artist string `yaml:"artist,omitempty"`
 	// Album is then name of the "album" directory that is created in the "artist"
 	// directory.
-	Album string `yaml:"album"`
+	Album string `yaml:"album,omitempty"`
 	// Presets references all presets to use.
-	Presets []string `yaml:"presets"`
+	Presets []string `yaml:"presets,omitempty"`
+}
+
+// ProgramSelector selects programs from SR's programs index. Programs must
+// match all of the specified criteria.
+type ProgramSelector struct {
+	// ChannelID selects programs of a channel, such as 163 for P2.
+	ChannelID int `yaml:"channelId"`
+	// CategoryID selects programs of a program category, such as 5 for music.
+	CategoryID int `yaml:"categoryId"`
+	// NamePattern is a regular expression selecting programs by name.
+	NamePattern string `yaml:"namePattern"`
+	// IncludeArchived selects programs that are no longer produced.
+	IncludeArchived bool `yaml:"includeArchived"`
 }
 
 // readYamlFromFile parses a YAML file from path into v.
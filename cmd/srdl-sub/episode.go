@@ -10,26 +10,31 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/AlexGustafsson/srdl/internal/fsutil"
 	"github.com/AlexGustafsson/srdl/internal/httputil"
-	"github.com/AlexGustafsson/srdl/internal/mp4"
 	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/AlexGustafsson/srdl/internal/state"
+	"github.com/AlexGustafsson/srdl/internal/tagging"
 )
 
 // processEpisode processes a single episode.
-// Returns whether or not the episode was downloaded (since episodes can be
-// processed but not downloaded if they're already downloaded).
-func processEpisode(ctx context.Context, episode sr.Episode, config Preset, outputPath string, log *slog.Logger) (bool, error) {
+// Returns the path to the episode's audio file once resolved and whether or
+// not the episode was downloaded (since episodes can be processed but not
+// downloaded if they're already downloaded). Downloaded episodes are recorded
+// in state. If plan is set, the episode is added to plan instead of being
+// downloaded.
+func processEpisode(ctx context.Context, episode sr.Episode, program *sr.Program, config Preset, outputPath string, store *state.Store, plan *SubscriptionPlan, log *slog.Logger) (string, bool, error) {
 	log = log.With(slog.Int("episode", episode.ID))
 	log.Debug("Processing episode")
 
 	if config.Retention > 0 && time.Since(episode.PublishDate.Time) > config.DownloadRange {
 		log.Debug("Skipping old episode", slog.Time("publishDate", episode.PublishDate.Time))
-		return false, nil
+		return "", false, nil
 	}
 
 	if episode.Broadcast == nil && episode.PodFile == nil {
 		log.Warn("No broadcast or pod available for the episode")
-		return false, fmt.Errorf("no broadcast or pod")
+		return "", false, fmt.Errorf("no broadcast or pod")
 	}
 
 	var url string
@@ -44,7 +49,7 @@ func processEpisode(ctx context.Context, episode sr.Episode, config Preset, outp
 
 	if url == "" {
 		log.Warn("No available file found for the episode")
-		return false, fmt.Errorf("no broadcast or pod files")
+		return "", false, fmt.Errorf("no broadcast or pod files")
 	}
 
 	// NOTE: Sometimes the API seems to return html5desktop, which is redirected
@@ -56,72 +61,153 @@ func processEpisode(ctx context.Context, episode sr.Episode, config Preset, outp
 
 	audioOutputPath := filepath.Join(outputPath, episode.Title+extension)
 
+	// Episodes that have been moved or renamed since they were downloaded are
+	// only known to the state. The images of episodes that are still where they
+	// were downloaded to are kept up to date below
+	entry, recorded := store.Get(episode.ID)
+	if recorded && (plan != nil || entry.Path != audioOutputPath) {
+		log.Debug("Skipping episode that is already downloaded", slog.String("path", entry.Path))
+		return entry.Path, false, nil
+	}
+
+	if plan != nil {
+		return planEpisode(episode, url, audioOutputPath, extension != "", plan, log)
+	}
+
 	// Try to download the episode's image
-	if err := httputil.DownloadIfNotExist(ctx, filepath.Join(outputPath, episode.Title), episode.ImageURL); err != nil {
+	imageURL := episode.ImageURL
+	if config.Images.EpisodePreset != "" {
+		imageURL = sr.ImageURL(episode.ImageURLTemplate, config.Images.EpisodePreset)
+	}
+
+	if err := httputil.DownloadOrRefresh(ctx, filepath.Join(outputPath, episode.Title), imageURL, config.Images.RefreshInterval); err != nil {
 		log.Warn("Failed to download episode image", slog.Any("error", err))
 		// Fallthrough
 	}
 
-	// Check if episode audio file already exists
-	_, err := os.Stat(audioOutputPath)
-	if err == nil {
-		log.Debug("Skipping episode that is already downloaded")
-		return false, nil
-	} else if !os.IsNotExist(err) {
-		log.Error("Failed to identify if the episode is already downloaded", slog.Any("error", err))
-		return false, err
+	if recorded {
+		log.Debug("Skipping episode that is already downloaded", slog.String("path", entry.Path))
+		return entry.Path, false, nil
+	}
+
+	// Check if episode audio file already exists. If the extension is unknown,
+	// it's checked once the file's content type is known
+	if extension != "" {
+		exists, err := episodeExists(audioOutputPath)
+		if err != nil {
+			log.Error("Failed to identify if the episode is already downloaded", slog.Any("error", err))
+			return audioOutputPath, false, err
+		} else if exists {
+			log.Debug("Skipping episode that is already downloaded")
+			return audioOutputPath, false, nil
+		}
 	}
 
 	if config.Throttling.DownloadDelay > 0 {
 		log.Debug("Waiting before proceeding with download", slog.Duration("delay", config.Throttling.DownloadDelay))
 		select {
 		case <-ctx.Done():
-			return false, ctx.Err()
+			return audioOutputPath, false, ctx.Err()
 		case <-time.After(config.Throttling.DownloadDelay):
 		}
 	}
 
-	file, err := os.OpenFile(audioOutputPath, os.O_CREATE|os.O_RDWR, 0644)
+	res, err := httputil.Get(ctx, url)
 	if err != nil {
-		log.Error("Failed to create output file", slog.Any("error", err))
-		return false, err
+		log.Error("Failed to download file", slog.Any("error", err))
+		return audioOutputPath, false, err
+	}
+	defer res.Body.Close()
+
+	if extension == "" {
+		extension = httputil.ExtensionByContentType(res.Header.Get("Content-Type"))
+		audioOutputPath = filepath.Join(outputPath, episode.Title+extension)
+
+		exists, err := episodeExists(audioOutputPath)
+		if err != nil {
+			log.Error("Failed to identify if the episode is already downloaded", slog.Any("error", err))
+			return audioOutputPath, false, err
+		} else if exists {
+			log.Debug("Skipping episode that is already downloaded")
+			return audioOutputPath, false, nil
+		}
 	}
-	defer file.Close()
 
-	episodeFile, err := httputil.Download(ctx, url)
+	// Write to a temporary file that replaces the output file once complete, to
+	// never leave partially downloaded episodes
+	file, err := fsutil.CreateAtomic(audioOutputPath, 0644)
 	if err != nil {
-		log.Error("Failed to download file", slog.Any("error", err))
-		return false, err
+		log.Error("Failed to create output file", slog.Any("error", err))
+		return audioOutputPath, false, err
 	}
-	defer episodeFile.Close()
+	defer file.Close()
 
-	if _, err := io.Copy(file, episodeFile); err != nil {
+	if _, err := io.Copy(file, res.Body); err != nil {
 		log.Error("Failed to download file", slog.Any("error", err))
-		return false, err
-	}
-
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		log.Warn("Failed to process metadata", slog.Any("error", err))
-		// Ignore the error as it's not critical, but don't continue further
-		return true, nil
+		return audioOutputPath, false, err
 	}
 
 	// Populate MP4 (m4a) files with metadata. SR already includes metadata in MP3
 	// files
 	if extension == ".m4a" {
-		meta := mp4.Metadata{
-			Title:       episode.Title,
-			Album:       episode.Program.Name,
-			Description: episode.Description,
-			Released:    episode.PublishDate.Time,
-		}
+		meta := tagging.Metadata(&episode, program, url)
 
-		if err := meta.Write(file); err != nil {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			log.Warn("Failed to process metadata", slog.Any("error", err))
+			// Ignore the error as it's not critical
+		} else if err := meta.Write(file.File); err != nil {
 			log.Warn("Failed to write metadata", slog.Any("error", err))
-			// Ignore the error as it's not critical, but don't continue further
-			return true, nil
+			// Ignore the error as it's not critical
+		}
+	}
+
+	if err := file.Commit(); err != nil {
+		log.Error("Failed to write output file", slog.Any("error", err))
+		return audioOutputPath, false, err
+	}
+
+	if err := store.Record(episode.ID, state.Entry{Path: audioOutputPath, RecordedAt: time.Now()}); err != nil {
+		log.Warn("Failed to record downloaded episode", slog.Any("error", err))
+		// Ignore the error, the episode is still identified by its file
+	}
+
+	return audioOutputPath, true, nil
+}
+
+// episodeExists returns whether or not the episode at path has been
+// downloaded.
+func episodeExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	} else if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// planEpisode adds the episode to plan, unless it's already downloaded.
+func planEpisode(episode sr.Episode, url string, audioOutputPath string, hasExtension bool, plan *SubscriptionPlan, log *slog.Logger) (string, bool, error) {
+	// Without an extension, whether or not the episode is downloaded is only
+	// known once downloaded
+	if hasExtension {
+		exists, err := episodeExists(audioOutputPath)
+		if err != nil {
+			log.Error("Failed to identify if the episode is already downloaded", slog.Any("error", err))
+			return audioOutputPath, false, err
+		} else if exists {
+			log.Debug("Skipping episode that is already downloaded")
+			return audioOutputPath, false, nil
 		}
 	}
 
-	return true, nil
+	plan.Downloads = append(plan.Downloads, PlannedDownload{
+		EpisodeID: episode.ID,
+		Title:     episode.Title,
+		URL:       url,
+		Path:      audioOutputPath,
+	})
+
+	return audioOutputPath, true, nil
 }
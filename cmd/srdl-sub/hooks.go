@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/httputil"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+)
+
+// DefaultHookTimeout is the maximum time a hook may run unless configured
+// otherwise.
+const DefaultHookTimeout = 30 * time.Second
+
+// HookEvent is the kind of event that triggers a hook.
+type HookEvent string
+
+const (
+	// HookEventDownloaded is fired when an episode has been downloaded.
+	HookEventDownloaded HookEvent = "downloaded"
+	// HookEventFailed is fired when an episode failed to download.
+	HookEventFailed HookEvent = "failed"
+	// HookEventRemoved is fired when an episode's audio file is removed due to
+	// retention.
+	HookEventRemoved HookEvent = "removed"
+)
+
+// Hook is a follow-up action, such as running a command or calling a webhook,
+// that is triggered by events such as an episode being downloaded.
+type Hook struct {
+	// Events are the events that trigger the hook. All events trigger the hook
+	// unless set.
+	Events []HookEvent `yaml:"events"`
+	// Command is the command and its arguments to run. The event is described
+	// by SRDL_* environment variables and a JSON payload written to stdin.
+	Command []string `yaml:"command"`
+	// URL is the URL of a webhook to which the event's JSON payload is posted.
+	URL string `yaml:"url"`
+	// Headers are additional headers to send with webhook requests.
+	Headers map[string]string `yaml:"headers"`
+	// Timeout is the maximum time the hook may run.
+	// Defaults to [DefaultHookTimeout].
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// HookPayload describes an event.
+type HookPayload struct {
+	Event HookEvent `json:"event"`
+	// Path is the path to the episode's file.
+	Path    string      `json:"path"`
+	Episode *sr.Episode `json:"episode,omitempty"`
+	Program *sr.Program `json:"program,omitempty"`
+	// Error describes why an episode failed to download.
+	Error string `json:"error,omitempty"`
+}
+
+// Handles returns whether or not the hook is triggered by event.
+func (h Hook) Handles(event HookEvent) bool {
+	return len(h.Events) == 0 || slices.Contains(h.Events, event)
+}
+
+// Run runs the hook's command and webhook, if configured.
+func (h Hook) Run(ctx context.Context, payload HookPayload) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	if len(h.Command) > 0 {
+		if err := h.runCommand(ctx, payload, body); err != nil {
+			errs = append(errs, fmt.Errorf("command: %w", err))
+		}
+	}
+
+	if h.URL != "" {
+		if err := h.callWebhook(ctx, body); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (h Hook) runCommand(ctx context.Context, payload HookPayload, body []byte) error {
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), hookEnvironment(payload)...)
+	// Don't wait for orphaned child processes holding on to the output
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if len(output) > 0 {
+			return fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (h Hook) callWebhook(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range h.Headers {
+		req.Header.Set(key, value)
+	}
+
+	res, err := httputil.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// hookEnvironment returns the environment variables describing payload.
+func hookEnvironment(payload HookPayload) []string {
+	env := []string{
+		"SRDL_EVENT=" + string(payload.Event),
+		"SRDL_PATH=" + payload.Path,
+	}
+
+	if payload.Episode != nil {
+		env = append(env,
+			"SRDL_EPISODE_ID="+strconv.Itoa(payload.Episode.ID),
+			"SRDL_EPISODE_TITLE="+payload.Episode.Title,
+		)
+	}
+
+	if payload.Program != nil {
+		env = append(env,
+			"SRDL_PROGRAM_ID="+strconv.Itoa(payload.Program.ID),
+			"SRDL_PROGRAM_NAME="+payload.Program.Name,
+		)
+	}
+
+	if payload.Error != "" {
+		env = append(env, "SRDL_ERROR="+payload.Error)
+	}
+
+	return env
+}
+
+// runHooks runs all hooks triggered by the payload's event. Hooks are not
+// critical, so failures are logged rather than returned.
+func runHooks(ctx context.Context, hooks []Hook, payload HookPayload, log *slog.Logger) {
+	for i, hook := range hooks {
+		if !hook.Handles(payload.Event) {
+			continue
+		}
+
+		log := log.With(slog.Int("hook", i), slog.String("event", string(payload.Event)))
+		log.Debug("Running hook")
+		if err := hook.Run(ctx, payload); err != nil {
+			log.Warn("Failed to run hook", slog.Any("error", err))
+			// Fallthrough
+		}
+	}
+}
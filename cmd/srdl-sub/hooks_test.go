@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookRunCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	output := filepath.Join(t.TempDir(), "output")
+
+	hook := Hook{
+		Command: []string{"sh", "-c", `echo "$SRDL_EVENT $SRDL_EPISODE_ID $SRDL_PROGRAM_NAME $SRDL_PATH" > "$0" && cat >> "$0"`, output},
+	}
+
+	payload := HookPayload{
+		Event:   HookEventDownloaded,
+		Path:    "/output/Carpe diem.m4a",
+		Episode: &sr.Episode{ID: 2479556, Title: "Carpe diem"},
+		Program: &sr.Program{ID: 4914, Name: "Text och musik med Eric Schüldt"},
+	}
+
+	require.NoError(t, hook.Run(context.TODO(), payload))
+
+	content, err := os.ReadFile(output)
+	require.NoError(t, err)
+
+	line, stdin, _ := strings.Cut(string(content), "\n")
+	assert.Equal(t, "downloaded 2479556 Text och musik med Eric Schüldt /output/Carpe diem.m4a", line)
+
+	var actual HookPayload
+	require.NoError(t, json.Unmarshal([]byte(stdin), &actual))
+	assert.Equal(t, payload, actual)
+}
+
+func TestHookRunFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	testCases := []struct {
+		Name string
+		Hook Hook
+	}{
+		{
+			Name: "Exit code",
+			Hook: Hook{Command: []string{"sh", "-c", "echo failed; exit 1"}},
+		},
+		{
+			Name: "Timeout",
+			Hook: Hook{Command: []string{"sleep", "10"}, Timeout: 10 * time.Millisecond},
+		},
+		{
+			Name: "Missing command",
+			Hook: Hook{Command: []string{"srdl-missing-command"}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			assert.Error(t, testCase.Hook.Run(context.TODO(), HookPayload{Event: HookEventFailed}))
+		})
+	}
+}
+
+func TestHookRunWebhook(t *testing.T) {
+	var received []HookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var payload HookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		received = append(received, payload)
+	}))
+	defer server.Close()
+
+	payload := HookPayload{
+		Event:   HookEventRemoved,
+		Path:    "/output/Carpe diem.m4a",
+		Program: &sr.Program{ID: 4914, Name: "Text och musik med Eric Schüldt"},
+	}
+
+	hook := Hook{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	}
+	require.NoError(t, hook.Run(context.TODO(), payload))
+	assert.Equal(t, []HookPayload{payload}, received)
+
+	hook.Headers = nil
+	assert.Error(t, hook.Run(context.TODO(), payload))
+}
+
+func TestHookHandles(t *testing.T) {
+	assert.True(t, Hook{}.Handles(HookEventDownloaded))
+	assert.True(t, Hook{Events: []HookEvent{HookEventDownloaded}}.Handles(HookEventDownloaded))
+	assert.False(t, Hook{Events: []HookEvent{HookEventDownloaded}}.Handles(HookEventRemoved))
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+	"unicode"
+
+	"github.com/AlexGustafsson/srdl/internal/httputil"
+	"github.com/AlexGustafsson/srdl/internal/mp4"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/AlexGustafsson/srdl/internal/state"
+	"github.com/AlexGustafsson/srdl/internal/tagging"
+)
+
+// audioExtensions are the extensions of episodes' audio files, such as those
+// that are imported.
+var audioExtensions = []string{".m4a", ".mp4", ".mp3"}
+
+// importDatePattern matches dates in file names, such as
+// "2024-11-09 Carpe diem.mp3".
+var importDatePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// importLocation is the time zone of SR's episodes. Publish dates are
+// compared in it, as that's how other tools typically name files. Time zone
+// data is embedded, as the docker image has none.
+var importLocation = func() *time.Location {
+	location, err := time.LoadLocation("Europe/Stockholm")
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}()
+
+// minImportDurationTolerance is the minimum difference in duration between a
+// file and an episode for them to be considered the same. Files re-encoded by
+// other tools rarely have the exact same duration.
+const minImportDurationTolerance = 10 * time.Second
+
+// Ways imported files are matched with episodes.
+const (
+	importMatchTags            = "tags"
+	importMatchTitle           = "title"
+	importMatchDateAndDuration = "date and duration"
+)
+
+// Statuses of imported files.
+const (
+	importStatusImported  = "imported"
+	importStatusRecorded  = "recorded"
+	importStatusUnmatched = "unmatched"
+)
+
+// ImportReport describes the result of importing an existing archive.
+type ImportReport struct {
+	// DryRun is whether or not the state was left as is.
+	DryRun  bool           `json:"dryRun"`
+	Results []ImportResult `json:"results"`
+}
+
+// ImportResult describes how a file of an imported archive was matched with
+// an episode.
+type ImportResult struct {
+	Path string `json:"path"`
+	// Status is either "imported", "recorded" if the episode was already
+	// recorded in the state or "unmatched".
+	Status    string `json:"status"`
+	EpisodeID int    `json:"episodeId,omitempty"`
+	Title     string `json:"title,omitempty"`
+	// MatchedBy is how the file was matched with its episode.
+	MatchedBy string `json:"matchedBy,omitempty"`
+}
+
+// importFile describes a file of an imported archive.
+type importFile struct {
+	// EpisodeID is the id of the file's episode, if stored in its SR
+	// identifiers.
+	EpisodeID int
+	// TaggedEpisodeID is the episode id tag (tven) of the file. Other taggers
+	// use it for their own episode numbers, so it's only trusted if it
+	// identifies a listed episode.
+	TaggedEpisodeID int
+	// Titles are the possible titles of the file's episode, based on its tags
+	// and name.
+	Titles []string
+	// Date is the publish date of the file's episode, formatted as
+	// [time.DateOnly], if known.
+	Date string
+	// Duration is the duration of the file, if known.
+	Duration time.Duration
+}
+
+// importCommand is the entrypoint of the "import" command.
+func importCommand(ctx context.Context, args []string) error {
+	commandLine := flag.NewFlagSet(os.Args[0]+" import", flag.ExitOnError)
+
+	configFilePath := commandLine.String("config", "", "Config file path")
+	subscriptionsFilePath := commandLine.String("subscriptions", "", "Subscriptions file path")
+	dryRun := commandLine.Bool("dry-run", false, "Print how files would be matched, without recording them")
+	format := commandLine.String("format", "text", "Format of the report, either text or json")
+	commandLine.Parse(args)
+
+	if *configFilePath == "" || *subscriptionsFilePath == "" || commandLine.NArg() == 0 || (*format != "text" && *format != "json") {
+		commandLine.Usage()
+		os.Exit(1)
+	}
+
+	var config Config
+	if err := readYamlFromFile(*configFilePath, &config); err != nil {
+		return err
+	}
+
+	var subscriptions map[string]Subscription
+	if err := readYamlFromFile(*subscriptionsFilePath, &subscriptions); err != nil {
+		return err
+	}
+
+	if config.State == "" {
+		return fmt.Errorf("no state configured, set state in the config to import into")
+	}
+
+	logLevel, err := config.SlogLogLevel()
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+
+	if config.Cache.Directory != "" {
+		httputil.UseCache(config.Cache.Directory, config.Cache.TTL)
+	}
+
+	report, err := importArchive(ctx, config, subscriptions, commandLine.Args(), *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		return report.WriteJSON(os.Stdout)
+	}
+
+	return report.WriteText(os.Stdout)
+}
+
+// importArchive matches the audio files in dirs with the episodes of the
+// subscribed programs and records them in the state, so that they're not
+// downloaded again. Files are matched by the SR identifiers in their tags, or
+// by their titles, publish dates and durations. If dryRun is set, the state is
+// left as is.
+func importArchive(ctx context.Context, config Config, subscriptions map[string]Subscription, dirs []string, dryRun bool) (*ImportReport, error) {
+	store, err := state.Open(config.State)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := importPaths(dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	programIDCachePath := ""
+	if config.Cache.Directory != "" {
+		programIDCachePath = filepath.Join(config.Cache.Directory, "programs.json")
+	}
+	subscriptions, resolveErrors, err := resolveSubscriptions(ctx, subscriptions, newProgramIDCache(programIDCachePath))
+	if err != nil {
+		return nil, err
+	}
+
+	// Files are matched with all episodes of the subscribed programs
+	episodes := make([]sr.Episode, 0)
+	listed := make(map[int]bool)
+	for _, subscriptionID := range slices.Sorted(maps.Keys(subscriptions)) {
+		subscription := subscriptions[subscriptionID]
+
+		log := slog.With(slog.String("subscription", subscriptionID), slog.Int("programId", subscription.ProgramID))
+		if err := resolveErrors[subscriptionID]; err != nil {
+			log.Warn("Failed to identify program, files are not matched with its episodes", slog.Any("error", err))
+			continue
+		}
+
+		if listed[subscription.ProgramID] {
+			continue
+		}
+		listed[subscription.ProgramID] = true
+
+		programEpisodes, err := retryIfRateLimited(ctx, log, func() ([]sr.Episode, error) {
+			return sr.DefaultClient.ListAllEpisodesInProgram(ctx, subscription.ProgramID)
+		})
+		if errors.Is(err, sr.ErrBlocked) {
+			log.Error("Requests are blocked by SR, aborting")
+			return nil, err
+		} else if err != nil {
+			log.Warn("Failed to list episodes, files are not matched with them", slog.Any("error", err))
+			continue
+		}
+
+		episodes = append(episodes, programEpisodes...)
+	}
+
+	report := &ImportReport{
+		DryRun:  dryRun,
+		Results: make([]ImportResult, 0, len(paths)),
+	}
+
+	for _, path := range paths {
+		file := readImportFile(path)
+		result := ImportResult{
+			Path:   path,
+			Status: importStatusUnmatched,
+		}
+
+		tagged := slices.IndexFunc(episodes, func(episode sr.Episode) bool {
+			return episode.ID == file.TaggedEpisodeID
+		})
+
+		if file.EpisodeID != 0 {
+			result.EpisodeID = file.EpisodeID
+			result.MatchedBy = importMatchTags
+
+			// Episodes of programs that are not subscribed to are not listed
+			index := slices.IndexFunc(episodes, func(episode sr.Episode) bool {
+				return episode.ID == file.EpisodeID
+			})
+			if index >= 0 {
+				result.Title = episodes[index].Title
+			}
+		} else if file.TaggedEpisodeID != 0 && tagged >= 0 {
+			result.EpisodeID = episodes[tagged].ID
+			result.Title = episodes[tagged].Title
+			result.MatchedBy = importMatchTags
+		} else if episode, matchedBy := matchEpisode(file, episodes); episode != nil {
+			result.EpisodeID = episode.ID
+			result.Title = episode.Title
+			result.MatchedBy = matchedBy
+		}
+
+		if result.EpisodeID != 0 {
+			if _, ok := store.Get(result.EpisodeID); ok {
+				result.Status = importStatusRecorded
+			} else {
+				result.Status = importStatusImported
+				store.Set(result.EpisodeID, state.Entry{
+					Path:       path,
+					RecordedAt: time.Now(),
+					Imported:   true,
+				})
+			}
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	if err := store.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save state: %w", err)
+	}
+
+	return report, nil
+}
+
+// importPaths returns the sorted paths of the audio files in dirs. Hidden
+// files and directories are skipped.
+func importPaths(dirs []string) ([]string, error) {
+	paths := make([]string, 0)
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if path != dir && strings.HasPrefix(entry.Name(), ".") {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if entry.Type().IsRegular() && slices.Contains(audioExtensions, strings.ToLower(filepath.Ext(path))) {
+				paths = append(paths, path)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slices.Sort(paths)
+	return slices.Compact(paths), nil
+}
+
+// readImportFile returns what's known about the file at path from its tags and
+// name. Tags and durations are only read from MP4 files. Files that cannot be
+// read are described by their name only.
+func readImportFile(path string) importFile {
+	var file importFile
+
+	if extension := strings.ToLower(filepath.Ext(path)); extension == ".m4a" || extension == ".mp4" {
+		readImportFileTags(path, &file)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if date := importDatePattern.FindString(name); date != "" {
+		if _, err := time.Parse(time.DateOnly, date); err == nil && file.Date == "" {
+			file.Date = date
+		}
+		name = importDatePattern.ReplaceAllString(name, "")
+	}
+
+	if name = strings.Trim(name, " -_."); name != "" {
+		file.Titles = append(file.Titles, name)
+	}
+
+	return file
+}
+
+// readImportFileTags describes file using the tags and duration of the MP4
+// file at path.
+func readImportFileTags(path string, file *importFile) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	if duration, err := mp4.ReadDuration(f, stat.Size()); err == nil {
+		file.Duration = duration
+	}
+
+	metadata, err := mp4.ReadMetadata(f, stat.Size())
+	if err != nil {
+		return
+	}
+
+	file.EpisodeID = tagging.ReadIdentifiers(metadata).EpisodeID
+	file.TaggedEpisodeID, _ = strconv.Atoi(metadata.EpisodeID)
+
+	if metadata.Title != "" {
+		file.Titles = append(file.Titles, metadata.Title)
+	}
+
+	if !metadata.Released.IsZero() {
+		file.Date = metadata.Released.In(importLocation).Format(time.DateOnly)
+	}
+}
+
+// matchEpisode returns the only episode matching file, and how it was matched.
+// Files are matched by title, as they're typically named after their
+// episodes. Recurring titles are told apart by publish date and duration, if
+// known. Files without a matching title are matched by publish date and
+// duration if both are known. Returns nil if no single episode matches.
+func matchEpisode(file importFile, episodes []sr.Episode) (*sr.Episode, string) {
+	titles := make([]string, 0, len(file.Titles))
+	for _, title := range file.Titles {
+		if title = normalizeTitle(title); title != "" {
+			titles = append(titles, title)
+		}
+	}
+
+	var candidates []*sr.Episode
+	for i, episode := range episodes {
+		if slices.Contains(titles, normalizeTitle(episode.Title)) && matchesDateAndDuration(file, &episode) {
+			candidates = append(candidates, &episodes[i])
+		}
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0], importMatchTitle
+	} else if len(candidates) > 1 || file.Date == "" || file.Duration == 0 {
+		return nil, ""
+	}
+
+	for i, episode := range episodes {
+		if matchesDateAndDuration(file, &episode) {
+			candidates = append(candidates, &episodes[i])
+		}
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0], importMatchDateAndDuration
+	}
+
+	return nil, ""
+}
+
+// matchesDateAndDuration returns whether or not the publish date and duration
+// of file match those of episode. Unknown dates and durations always match.
+func matchesDateAndDuration(file importFile, episode *sr.Episode) bool {
+	if file.Date != "" && file.Date != episode.PublishDate.In(importLocation).Format(time.DateOnly) {
+		return false
+	}
+
+	duration := episodeDuration(episode)
+	if file.Duration == 0 || duration == 0 {
+		return true
+	}
+
+	tolerance := max(minImportDurationTolerance, duration/50)
+	difference := file.Duration - duration
+	return difference <= tolerance && difference >= -tolerance
+}
+
+// episodeDuration returns the duration of the episode's audio file, preferring
+// broadcasts over pods like [processEpisode]. Returns zero if unknown.
+func episodeDuration(episode *sr.Episode) time.Duration {
+	if episode.Broadcast != nil {
+		if len(episode.Broadcast.Files) > 0 {
+			return time.Duration(episode.Broadcast.Files[0].Duration) * time.Second
+		}
+	} else if episode.PodFile != nil {
+		return time.Duration(episode.PodFile.Duration) * time.Second
+	}
+
+	return 0
+}
+
+// normalizeTitle returns title in lower case, without any characters other
+// than letters and digits. Tools name files differently, such as by replacing
+// characters that are not allowed in file names.
+func normalizeTitle(title string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, title)
+}
+
+// WriteText writes a human-readable description of the report to w.
+func (r *ImportReport) WriteText(w io.Writer) error {
+	var builder strings.Builder
+
+	counts := make(map[string]int)
+	for _, result := range r.Results {
+		counts[result.Status]++
+
+		switch result.Status {
+		case importStatusImported, importStatusRecorded:
+			label := "Imported"
+			if result.Status == importStatusRecorded {
+				label = "Already recorded"
+			}
+
+			fmt.Fprintf(&builder, "%s: %s -> episode %d", label, result.Path, result.EpisodeID)
+			if result.Title != "" {
+				fmt.Fprintf(&builder, " (%s)", result.Title)
+			}
+			fmt.Fprintf(&builder, ", matched by %s\n", result.MatchedBy)
+		default:
+			fmt.Fprintf(&builder, "Unmatched: %s\n", result.Path)
+		}
+	}
+
+	if len(r.Results) > 0 {
+		builder.WriteString("\n")
+	}
+
+	fmt.Fprintf(&builder, "%d imported, %d already recorded, %d unmatched\n", counts[importStatusImported], counts[importStatusRecorded], counts[importStatusUnmatched])
+	if r.DryRun {
+		builder.WriteString("Dry run, the state was not modified\n")
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// WriteJSON writes the report as indented JSON to w.
+func (r *ImportReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/mp4"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/AlexGustafsson/srdl/internal/sr/srtest"
+	"github.com/AlexGustafsson/srdl/internal/state"
+	"github.com/AlexGustafsson/srdl/internal/tagging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportArchive(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	archive := t.TempDir()
+
+	// Tagged by srdl
+	var tagged mp4.Metadata
+	tagging.Identifiers{EpisodeID: 2531337}.Write(&tagged)
+	createImportedFile(t, filepath.Join(archive, "tagged.m4a"), time.Second, tagged)
+
+	// Named by another tool
+	require.NoError(t, os.WriteFile(filepath.Join(archive, "2024-10-13 - Detta är skönheten.mp3"), []byte("ID3"), 0644))
+
+	// Named and tagged by another tool, without a matching title
+	createImportedFile(t, filepath.Join(archive, "Text och musik", "Inspelning.m4a"), 59*time.Minute, mp4.Metadata{
+		Released: time.Date(2025, 7, 20, 0, 0, 0, 0, time.UTC),
+	})
+
+	require.NoError(t, os.WriteFile(filepath.Join(archive, "Text och musik", "Okänt avsnitt.mp3"), []byte("ID3"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(archive, "Text och musik", ".Carpe diem.mp3"), []byte("ID3"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(archive, "notes.txt"), []byte("notes"), 0644))
+
+	config := Config{
+		State: filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	subscriptions := map[string]Subscription{
+		"textochmusik":    {ProgramID: 4914},
+		"musikprofessorn": {ProgramID: 5082},
+	}
+
+	expected := []ImportResult{
+		{
+			Path:      "2024-10-13 - Detta är skönheten.mp3",
+			Status:    importStatusImported,
+			EpisodeID: 2479556,
+			Title:     "Detta är skönheten",
+			MatchedBy: importMatchTitle,
+		},
+		{
+			Path:      "Text och musik/Inspelning.m4a",
+			Status:    importStatusImported,
+			EpisodeID: 2522448,
+			Title:     "Carpe diem",
+			MatchedBy: importMatchDateAndDuration,
+		},
+		{
+			Path:   "Text och musik/Okänt avsnitt.mp3",
+			Status: importStatusUnmatched,
+		},
+		{
+			Path:      "tagged.m4a",
+			Status:    importStatusImported,
+			EpisodeID: 2531337,
+			Title:     "Varför låter en stråkkvartett som den gör?",
+			MatchedBy: importMatchTags,
+		},
+	}
+
+	// Dry runs leave the state as is
+	report, err := importArchive(context.TODO(), config, subscriptions, []string{archive}, true)
+	require.NoError(t, err)
+	assert.Equal(t, expected, relativeImportResults(t, archive, report))
+	assert.NoFileExists(t, config.State)
+
+	var buffer bytes.Buffer
+	require.NoError(t, report.WriteText(&buffer))
+	assert.Contains(t, buffer.String(), "Unmatched: "+filepath.Join(archive, "Text och musik", "Okänt avsnitt.mp3")+"\n")
+	assert.True(t, strings.HasSuffix(buffer.String(), "\n3 imported, 0 already recorded, 1 unmatched\nDry run, the state was not modified\n"))
+
+	report, err = importArchive(context.TODO(), config, subscriptions, []string{archive}, false)
+	require.NoError(t, err)
+	assert.Equal(t, expected, relativeImportResults(t, archive, report))
+
+	store, err := state.Open(config.State)
+	require.NoError(t, err)
+	entry, ok := store.Get(2522448)
+	require.True(t, ok)
+	assert.Equal(t, filepath.Join(archive, "Text och musik", "Inspelning.m4a"), entry.Path)
+	assert.True(t, entry.Imported)
+
+	// Importing again keeps the recorded episodes
+	report, err = importArchive(context.TODO(), config, subscriptions, []string{archive}, false)
+	require.NoError(t, err)
+	for _, result := range report.Results {
+		if result.EpisodeID != 0 {
+			assert.Equal(t, importStatusRecorded, result.Status)
+		}
+	}
+
+	// Imported episodes are not downloaded
+	output := t.TempDir()
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`
+logLevel: error
+state: `+config.State+`
+presets:
+  default:
+    throttling:
+      maxDownloadsPerProgram: 5
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+textochmusik:
+  programId: 4914
+  presets:
+    - default
+`)
+
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+	assert.Equal(t, []string{"backdrop.jpg", "cover.jpg"}, tree(t, output))
+}
+
+func TestImportArchiveEpisodeIDTag(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	archive := t.TempDir()
+
+	// Other taggers use the episode id tag for their own episode numbers
+	createImportedFile(t, filepath.Join(archive, "Avsnitt 12.m4a"), time.Second, mp4.Metadata{EpisodeID: "12"})
+	createImportedFile(t, filepath.Join(archive, "Avsnitt 13.m4a"), time.Second, mp4.Metadata{EpisodeID: "2479556"})
+	createImportedFile(t, filepath.Join(archive, "Avsnitt 14.m4a"), time.Second, mp4.Metadata{EpisodeID: "2531337"})
+
+	config := Config{
+		State: filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	subscriptions := map[string]Subscription{
+		"textochmusik": {ProgramID: 4914},
+	}
+
+	report, err := importArchive(context.TODO(), config, subscriptions, []string{archive}, false)
+	require.NoError(t, err)
+
+	// Only ids of episodes of subscribed programs are trusted
+	assert.Equal(t, []ImportResult{
+		{
+			Path:   "Avsnitt 12.m4a",
+			Status: importStatusUnmatched,
+		},
+		{
+			Path:      "Avsnitt 13.m4a",
+			Status:    importStatusImported,
+			EpisodeID: 2479556,
+			Title:     "Detta är skönheten",
+			MatchedBy: importMatchTags,
+		},
+		{
+			Path:   "Avsnitt 14.m4a",
+			Status: importStatusUnmatched,
+		},
+	}, relativeImportResults(t, archive, report))
+}
+
+func TestMatchEpisode(t *testing.T) {
+	episodes := []sr.Episode{
+		{
+			ID:          1,
+			Title:       "Melodikrysset",
+			PublishDate: sr.Time{Time: time.Date(2025, 7, 19, 8, 0, 0, 0, time.UTC)},
+			Broadcast:   &sr.Broadcast{Files: []sr.BroadcastFile{{Duration: 3600}}},
+		},
+		{
+			ID:          2,
+			Title:       "Melodikrysset",
+			PublishDate: sr.Time{Time: time.Date(2025, 7, 26, 8, 0, 0, 0, time.UTC)},
+			Broadcast:   &sr.Broadcast{Files: []sr.BroadcastFile{{Duration: 3600}}},
+		},
+		{
+			ID:    3,
+			Title: "Varför låter en stråkkvartett som den gör?",
+			// Published at 00:30 in Swedish time
+			PublishDate: sr.Time{Time: time.Date(2025, 8, 4, 22, 30, 0, 0, time.UTC)},
+			PodFile:     &sr.PodFile{Duration: 1740},
+		},
+	}
+
+	testCases := []struct {
+		Name              string
+		File              importFile
+		ExpectedEpisodeID int
+		ExpectedMatchedBy string
+	}{
+		{
+			Name:              "title",
+			File:              importFile{Titles: []string{"Varför låter en stråkkvartett som den gör_"}},
+			ExpectedEpisodeID: 3,
+			ExpectedMatchedBy: importMatchTitle,
+		},
+		{
+			Name: "ambiguous title",
+			File: importFile{Titles: []string{"melodikrysset"}},
+		},
+		{
+			Name:              "recurring title and date",
+			File:              importFile{Titles: []string{"Melodikrysset"}, Date: "2025-07-26"},
+			ExpectedEpisodeID: 2,
+			ExpectedMatchedBy: importMatchTitle,
+		},
+		{
+			Name: "title and other duration",
+			File: importFile{Titles: []string{"Varför låter en stråkkvartett som den gör?"}, Duration: 10 * time.Minute},
+		},
+		{
+			Name:              "date in swedish time and duration",
+			File:              importFile{Titles: []string{"Avsnitt"}, Date: "2025-08-05", Duration: 1745 * time.Second},
+			ExpectedEpisodeID: 3,
+			ExpectedMatchedBy: importMatchDateAndDuration,
+		},
+		{
+			Name: "date without duration",
+			File: importFile{Titles: []string{"Avsnitt"}, Date: "2025-08-05"},
+		},
+		{
+			Name: "nothing known",
+			File: importFile{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			episode, matchedBy := matchEpisode(testCase.File, episodes)
+			if testCase.ExpectedEpisodeID == 0 {
+				assert.Nil(t, episode)
+			} else {
+				require.NotNil(t, episode)
+				assert.Equal(t, testCase.ExpectedEpisodeID, episode.ID)
+			}
+			assert.Equal(t, testCase.ExpectedMatchedBy, matchedBy)
+		})
+	}
+}
+
+// createImportedFile writes an MP4 file of the specified duration and metadata
+// to path.
+func createImportedFile(t *testing.T, path string, duration time.Duration, metadata mp4.Metadata) {
+	content, err := os.ReadFile("../../internal/mp4/empty.m4a")
+	require.NoError(t, err)
+
+	file, err := mp4.Parse(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	// The fixture's timescale is 1000
+	mvhd := file.Find("moov", "mvhd")
+	require.NotNil(t, mvhd)
+	binary.BigEndian.PutUint32(mvhd.Data[12:16], uint32(duration.Milliseconds()))
+
+	var buffer bytes.Buffer
+	_, err = file.WriteTo(&buffer)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	require.NoError(t, os.WriteFile(path, buffer.Bytes(), 0644))
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.NoError(t, metadata.Write(f))
+}
+
+// relativeImportResults returns the results of report with paths relative to
+// root.
+func relativeImportResults(t *testing.T, root string, report *ImportReport) []ImportResult {
+	results := make([]ImportResult, 0, len(report.Results))
+	for _, result := range report.Results {
+		relative, err := filepath.Rel(root, result.Path)
+		require.NoError(t, err)
+		result.Path = filepath.ToSlash(relative)
+		results = append(results, result)
+	}
+	return results
+}
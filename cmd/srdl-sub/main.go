@@ -2,21 +2,81 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlexGustafsson/srdl/internal/httputil"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/AlexGustafsson/srdl/internal/state"
 )
 
+const usageTemplate = `usage: %[1]s [command] [options...]
+
+commands:
+- check
+- export-opml
+- import-opml
+- import
+
+examples:
+
+%[1]s -config config.yaml -subscriptions subscriptions.yaml
+%[1]s -config config.yaml -subscriptions subscriptions.yaml -dry-run
+%[1]s check -config config.yaml -subscriptions subscriptions.yaml
+%[1]s export-opml -subscriptions subscriptions.yaml -output subscriptions.opml
+%[1]s import-opml -presets throttle podcasts.opml >> subscriptions.yaml
+%[1]s import -config config.yaml -subscriptions subscriptions.yaml -dry-run archive
+
+options:
+`
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, usageTemplate, os.Args[0])
+	flag.PrintDefaults()
+}
+
 func main() {
 	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo})))
 
+	// Subcommands, running srdl-sub without one processes all subscriptions
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		var err error
+		switch command := os.Args[1]; command {
+		case "check":
+			err = check(os.Args[2:])
+		case "export-opml":
+			err = exportOPMLCommand(context.Background(), os.Args[2:])
+		case "import-opml":
+			err = importOPMLCommand(context.Background(), os.Args[2:])
+		case "import":
+			err = importCommand(context.Background(), os.Args[2:])
+		default:
+			err = fmt.Errorf("invalid command: %s", command)
+		}
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	flag.Usage = printUsage
+
 	configFilePath := flag.String("config", "", "Config file path")
 	subscriptionsFilePath := flag.String("subscriptions", "", "Subscriptions file path")
+	dryRunEnabled := flag.Bool("dry-run", false, "Print what would be downloaded and removed, without downloading or removing anything")
+	format := flag.String("format", "text", "Format of the dry run's plan, either text or json")
 
 	flag.Parse()
 
-	if *configFilePath == "" || *subscriptionsFilePath == "" {
+	if *configFilePath == "" || *subscriptionsFilePath == "" || (*format != "text" && *format != "json") {
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -47,12 +107,53 @@ func main() {
 		}
 	}()
 
+	if *dryRunEnabled {
+		plan, err := dryRun(ctx, *configFilePath, *subscriptionsFilePath)
+		if plan != nil {
+			var writeErr error
+			if *format == "json" {
+				writeErr = plan.WriteJSON(os.Stdout)
+			} else {
+				writeErr = plan.WriteText(os.Stdout)
+			}
+
+			if writeErr != nil {
+				slog.Error("Failed to write plan", slog.Any("error", writeErr))
+				os.Exit(1)
+			}
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := run(ctx, *configFilePath, *subscriptionsFilePath); err != nil {
 		os.Exit(1)
 	}
 }
 
+// run processes all subscriptions, downloading new episodes and removing old
+// ones.
 func run(ctx context.Context, configFilePath string, subscriptionsFilePath string) error {
+	return process(ctx, configFilePath, subscriptionsFilePath, nil)
+}
+
+// dryRun processes all subscriptions like [run], but only fetches metadata.
+// Returns a plan of what [run] would download and remove.
+func dryRun(ctx context.Context, configFilePath string, subscriptionsFilePath string) (*Plan, error) {
+	plan := &Plan{
+		Subscriptions: make([]*SubscriptionPlan, 0),
+	}
+
+	err := process(ctx, configFilePath, subscriptionsFilePath, plan)
+	plan.sortSubscriptions()
+	return plan, err
+}
+
+// process processes all subscriptions. If plan is set, nothing is downloaded
+// or removed. Instead, the plan of each subscription is added to plan.
+func process(ctx context.Context, configFilePath string, subscriptionsFilePath string, plan *Plan) error {
 	var config Config
 	if err := readYamlFromFile(configFilePath, &config); err != nil {
 		return err
@@ -70,19 +171,77 @@ func run(ctx context.Context, configFilePath string, subscriptionsFilePath strin
 
 	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
 
+	if config.Cache.Directory != "" {
+		httputil.UseCache(config.Cache.Directory, config.Cache.TTL)
+	}
+
+	// Resolve the programs of subscriptions identified by their program's URL or
+	// slug, or that select multiple programs
+	programIDCachePath := ""
+	if config.Cache.Directory != "" {
+		programIDCachePath = filepath.Join(config.Cache.Directory, "programs.json")
+	}
+	subscriptions, resolveErrors, err := resolveSubscriptions(ctx, subscriptions, newProgramIDCache(programIDCachePath))
+	if err != nil {
+		return err
+	}
+
+	store, err := state.Open(config.State)
+	if err != nil {
+		return err
+	}
+
 	// NOTE: Although all of the requests could be made parallel, let's keep them
 	// synchronous as it acts as a natural rate limit to make sure the load is
 	// fair
+	downloads := 0
+
+	// Let media servers pick up the new episodes without waiting for their
+	// scheduled scans, even if later subscriptions fail
+	defer func() {
+		if downloads > 0 && plan == nil {
+			notifyMediaServers(ctx, config.Notifiers)
+		}
+	}()
+
 	for subscriptionID, subscription := range subscriptions {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
 
+		var subscriptionPlan *SubscriptionPlan
+		if plan != nil {
+			subscriptionPlan = NewSubscriptionPlan(subscriptionID, subscription)
+			plan.Subscriptions = append(plan.Subscriptions, subscriptionPlan)
+		}
+
 		log := slog.With(slog.String("subscription", subscriptionID), slog.Int("programId", subscription.ProgramID))
-		if err := processSubscription(ctx, config, subscription, log); err != nil {
+		if err := resolveErrors[subscriptionID]; err != nil {
+			log.Error("Failed to identify program", slog.Any("error", err))
+			if subscriptionPlan != nil {
+				subscriptionPlan.Error = err.Error()
+			}
+			continue
+		}
+
+		subscriptionDownloads, err := processSubscription(ctx, config, subscription, store, subscriptionPlan, log)
+		downloads += subscriptionDownloads
+		if err != nil {
 			if err != ctx.Err() {
 				log.Error("Failed to process subscription", slog.Any("error", err))
 			}
+
+			if subscriptionPlan != nil {
+				subscriptionPlan.Error = err.Error()
+			}
+
+			// Further requests are likely to be blocked as well, so don't make it
+			// worse
+			if errors.Is(err, sr.ErrBlocked) {
+				log.Error("Requests are blocked by SR, aborting")
+				return err
+			}
+
 			continue
 		}
 	}
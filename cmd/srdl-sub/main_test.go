@@ -0,0 +1,690 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/httputil"
+	"github.com/AlexGustafsson/srdl/internal/mp4"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/AlexGustafsson/srdl/internal/sr/srtest"
+	"github.com/AlexGustafsson/srdl/internal/state"
+	"github.com/AlexGustafsson/srdl/internal/tagging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	output := t.TempDir()
+
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`
+logLevel: error
+presets:
+  throttle:
+    throttling:
+      maxDownloadsPerProgram: 5
+  audiobookshelf:
+    output: "`+output+`/{{.Program.Name}}"
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+textochmusik:
+  programId: 4914
+  presets:
+    - throttle
+    - audiobookshelf
+
+musikprofessorn:
+  programId: 5082
+  presets:
+    - throttle
+    - audiobookshelf
+`)
+
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+
+	assert.Equal(t, []string{
+		"Musikprofessorn",
+		"Musikprofessorn/Varför låter en stråkkvartett som den gör?.jpg",
+		"Musikprofessorn/Varför låter en stråkkvartett som den gör?.m4a",
+		"Musikprofessorn/backdrop.jpg",
+		"Musikprofessorn/cover.jpg",
+		"Text och musik med Eric Schüldt",
+		"Text och musik med Eric Schüldt/Carpe diem.jpg",
+		"Text och musik med Eric Schüldt/Carpe diem.m4a",
+		"Text och musik med Eric Schüldt/Detta är skönheten.jpg",
+		"Text och musik med Eric Schüldt/Detta är skönheten.m4a",
+		"Text och musik med Eric Schüldt/backdrop.jpg",
+		"Text och musik med Eric Schüldt/cover.jpg",
+	}, tree(t, output))
+
+	file, err := os.Open(filepath.Join(output, "Text och musik med Eric Schüldt", "Carpe diem.m4a"))
+	require.NoError(t, err)
+	defer file.Close()
+
+	stat, err := file.Stat()
+	require.NoError(t, err)
+	// The fixture's size plus the written metadata
+	assert.Greater(t, stat.Size(), int64(919))
+
+	metadata, err := mp4.ReadMetadata(file, stat.Size())
+	require.NoError(t, err)
+	assert.Equal(t, "Carpe diem", metadata.Title)
+	assert.Equal(t, "Text och musik med Eric Schüldt", metadata.Album)
+	assert.Equal(t, "P2", metadata.AlbumArtist)
+	assert.Equal(t, "Musik", metadata.Genre)
+	assert.True(t, metadata.Podcast)
+	assert.Equal(t, "2522448", metadata.EpisodeID)
+
+	identifiers := tagging.ReadIdentifiers(metadata)
+	assert.Equal(t, 2522448, identifiers.EpisodeID)
+	assert.Equal(t, 4914, identifiers.ProgramID)
+	assert.Equal(t, 163, identifiers.ChannelID)
+	assert.NotEmpty(t, identifiers.SourceURL)
+}
+
+func TestRunState(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	output := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`
+logLevel: error
+state: `+statePath+`
+presets:
+  default:
+    throttling:
+      maxDownloadsPerProgram: 5
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+textochmusik:
+  programId: 4914
+  presets:
+    - default
+`)
+
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+
+	store, err := state.Open(statePath)
+	require.NoError(t, err)
+	entry, ok := store.Get(2522448)
+	require.True(t, ok)
+	assert.Equal(t, filepath.Join(output, "Carpe diem.m4a"), entry.Path)
+	assert.False(t, entry.Imported)
+
+	// Moved episodes are not downloaded again
+	archive := t.TempDir()
+	require.NoError(t, os.Rename(entry.Path, filepath.Join(archive, "Carpe diem.m4a")))
+
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+
+	assert.Equal(t, []string{
+		"Carpe diem.jpg",
+		"Detta är skönheten.jpg",
+		"Detta är skönheten.m4a",
+		"backdrop.jpg",
+		"cover.jpg",
+	}, tree(t, output))
+}
+
+func TestRunRetention(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	output := t.TempDir()
+
+	// Add a recent episode and age the existing files to be removed by retention
+	publishDate := sr.Time{Time: time.Now().Add(-1 * time.Hour)}
+	server.AddEpisode(sr.Episode{
+		ID:          1,
+		Title:       "Nytt avsnitt",
+		Program:     sr.ProgramReference{ID: 5082, Name: "Musikprofessorn"},
+		PublishDate: publishDate,
+		ImageURL:    "https://static-cdn.sr.se/images/5082/1.jpg",
+		PodFile: &sr.PodFile{
+			ID:            1,
+			URL:           "https://sverigesradio.se/topsy/ljudfil/srapi/1.m4a",
+			AvailableFrom: publishDate,
+			Published:     publishDate,
+		},
+	})
+
+	events := make([]string, 0)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload HookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		relative, _ := filepath.Rel(output, payload.Path)
+		events = append(events, string(payload.Event)+" "+filepath.ToSlash(relative))
+	}))
+	defer webhook.Close()
+
+	// Only the removed episode, not its image or the image's metadata, fires
+	// hooks
+	for _, name := range []string{"Gammalt avsnitt.m4a", "Gammalt avsnitt.jpg", ".Gammalt avsnitt.jpg.http.json"} {
+		oldFilePath := filepath.Join(output, "Musikprofessorn", name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(oldFilePath), os.ModePerm))
+		require.NoError(t, os.WriteFile(oldFilePath, []byte{}, 0644))
+		require.NoError(t, os.Chtimes(oldFilePath, time.Now(), time.Now().Add(-48*time.Hour)))
+	}
+
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`/{{.Program.Name}}
+logLevel: error
+presets:
+  default:
+    downloadRange: 24h
+    retention: 24h
+    throttling:
+      maxDownloadsPerProgram: 5
+    hooks:
+      - events: [downloaded, removed]
+        url: `+webhook.URL+`
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+musikprofessorn:
+  programId: 5082
+  presets:
+    - default
+`)
+
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+
+	assert.Equal(t, []string{
+		"Musikprofessorn",
+		"Musikprofessorn/Nytt avsnitt.jpg",
+		"Musikprofessorn/Nytt avsnitt.m4a",
+		"Musikprofessorn/backdrop.jpg",
+		"Musikprofessorn/cover.jpg",
+	}, tree(t, output))
+
+	assert.Equal(t, []string{
+		"downloaded Musikprofessorn/Nytt avsnitt.m4a",
+		"removed Musikprofessorn/Gammalt avsnitt.m4a",
+	}, events)
+}
+
+func TestRunBlocked(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	server.SetBlocked(true)
+
+	output := t.TempDir()
+
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`
+logLevel: error
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+textochmusik:
+  programId: 4914
+`)
+
+	err := run(context.TODO(), configFilePath, subscriptionsFilePath)
+	assert.ErrorIs(t, err, sr.ErrBlocked)
+}
+
+func TestRunCache(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	output := t.TempDir()
+	cache := t.TempDir()
+
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`
+logLevel: error
+cache:
+  directory: `+cache+`
+  ttl: 1h
+presets:
+  throttle:
+    throttling:
+      maxDownloadsPerProgram: 5
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+textochmusik:
+  programId: 4914
+  presets:
+    - throttle
+`)
+
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+
+	assert.Equal(t, 1, server.Requests("/v2/programs/4914"))
+	assert.Equal(t, 1, server.Requests("/v2/episodes/index"))
+}
+
+func TestRunNotifiers(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	mediaServer, requests := newMediaServer(t)
+
+	output := t.TempDir()
+
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`
+logLevel: error
+notifiers:
+  jellyfin:
+    url: `+mediaServer.URL+`
+    apiKey: jellyfin-key
+  audiobookshelf:
+    url: `+mediaServer.URL+`
+    apiKey: audiobookshelf-key
+    libraries:
+      - podcasts
+presets:
+  throttle:
+    throttling:
+      maxDownloadsPerProgram: 5
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+musikprofessorn:
+  programId: 5082
+  presets:
+    - throttle
+`)
+
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+	assert.Equal(t, []string{
+		"POST /Library/Refresh",
+		"POST /api/libraries/podcasts/scan",
+	}, *requests)
+
+	// Nothing new is downloaded, so media servers are not notified
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+	assert.Len(t, *requests, 2)
+}
+
+func TestRunNotifiersBlocked(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	mediaServer, requests := newMediaServer(t)
+
+	// Requests are blocked once the first episode has been downloaded
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.SetBlocked(true)
+	}))
+	defer webhook.Close()
+
+	output := t.TempDir()
+
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`
+logLevel: error
+notifiers:
+  jellyfin:
+    url: `+mediaServer.URL+`
+    apiKey: jellyfin-key
+presets:
+  default:
+    throttling:
+      maxDownloadsPerProgram: 1
+    hooks:
+      - events: [downloaded]
+        url: `+webhook.URL+`
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+musikprofessorn:
+  programId: 5082
+  presets:
+    - default
+textochmusik:
+  programId: 4914
+  presets:
+    - default
+`)
+
+	err := run(context.TODO(), configFilePath, subscriptionsFilePath)
+	assert.ErrorIs(t, err, sr.ErrBlocked)
+
+	// The episode downloaded before being blocked is announced
+	assert.Equal(t, []string{"POST /Library/Refresh"}, *requests)
+}
+
+func TestRunProgramSlug(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	output := t.TempDir()
+	cache := t.TempDir()
+
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`/{{.Program.Name}}
+logLevel: error
+cache:
+  directory: `+cache+`
+presets:
+  throttle:
+    throttling:
+      maxDownloadsPerProgram: 1
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+textochmusik:
+  slug: textochmusikmedericschuldt
+  presets:
+    - throttle
+
+musikprofessorn:
+  url: `+server.URL+`/musikprofessorn
+  presets:
+    - throttle
+
+removed:
+  slug: removed
+  presets:
+    - throttle
+`)
+
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+
+	assert.Equal(t, []string{
+		"Musikprofessorn",
+		"Musikprofessorn/Varför låter en stråkkvartett som den gör?.jpg",
+		"Musikprofessorn/Varför låter en stråkkvartett som den gör?.m4a",
+		"Musikprofessorn/backdrop.jpg",
+		"Musikprofessorn/cover.jpg",
+		"Text och musik med Eric Schüldt",
+		"Text och musik med Eric Schüldt/Carpe diem.jpg",
+		"Text och musik med Eric Schüldt/Carpe diem.m4a",
+		"Text och musik med Eric Schüldt/backdrop.jpg",
+		"Text och musik med Eric Schüldt/cover.jpg",
+	}, tree(t, output))
+
+	// Resolved program ids are cached
+	plan, err := dryRun(context.TODO(), configFilePath, subscriptionsFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, 1, server.Requests("/textochmusikmedericschuldt"))
+	assert.Equal(t, 1, server.Requests("/musikprofessorn"))
+
+	require.Len(t, plan.Subscriptions, 3)
+	assert.Equal(t, 5082, plan.Subscriptions[0].ProgramID)
+	assert.Equal(t, "removed", plan.Subscriptions[1].ID)
+	assert.Contains(t, plan.Subscriptions[1].Error, "no longer resolves to a program")
+	assert.Equal(t, 4914, plan.Subscriptions[2].ProgramID)
+}
+
+func TestRunProgramSelector(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	// A program on another channel, which should not be selected
+	server.AddProgram(sr.Program{
+		ID:       1,
+		Name:     "Musik i P4",
+		Channel:  sr.ChannelReference{ID: 212, Name: "P4 Göteborg"},
+		Category: sr.ProgramCategory{ID: 5, Name: "Musik"},
+	})
+
+	output := t.TempDir()
+
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`/{{.Program.Name}}
+logLevel: error
+presets:
+  throttle:
+    throttling:
+      maxDownloadsPerProgram: 1
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+p2:
+  programs:
+    channelId: 163
+    categoryId: 5
+    namePattern: (?i)musik
+  presets:
+    - throttle
+
+musikprofessorn:
+  programId: 5082
+  presets:
+    - throttle
+`)
+
+	// Explicit subscriptions take precedence over selected programs
+	plan, err := dryRun(context.TODO(), configFilePath, subscriptionsFilePath)
+	require.NoError(t, err)
+	require.Len(t, plan.Subscriptions, 2)
+	assert.Equal(t, "musikprofessorn", plan.Subscriptions[0].ID)
+	assert.Equal(t, "p2/4914", plan.Subscriptions[1].ID)
+	assert.Equal(t, 4914, plan.Subscriptions[1].ProgramID)
+
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+
+	assert.Equal(t, []string{
+		"Musikprofessorn",
+		"Musikprofessorn/Varför låter en stråkkvartett som den gör?.jpg",
+		"Musikprofessorn/Varför låter en stråkkvartett som den gör?.m4a",
+		"Musikprofessorn/backdrop.jpg",
+		"Musikprofessorn/cover.jpg",
+		"Text och musik med Eric Schüldt",
+		"Text och musik med Eric Schüldt/Carpe diem.jpg",
+		"Text och musik med Eric Schüldt/Carpe diem.m4a",
+		"Text och musik med Eric Schüldt/backdrop.jpg",
+		"Text och musik med Eric Schüldt/cover.jpg",
+	}, tree(t, output))
+}
+
+func TestRunProgramSelectorSharedOutput(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	output := t.TempDir()
+
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`
+logLevel: error
+presets:
+  throttle:
+    throttling:
+      maxDownloadsPerProgram: 1
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+p2:
+  programs:
+    channelId: 163
+    categoryId: 5
+  presets:
+    - throttle
+
+musikprofessorn:
+  programId: 5082
+  presets:
+    - throttle
+`)
+
+	// Selected programs are output to their own directories, even though the
+	// output path is shared
+	plan, err := dryRun(context.TODO(), configFilePath, subscriptionsFilePath)
+	require.NoError(t, err)
+	require.Len(t, plan.Subscriptions, 2)
+	assert.Equal(t, output, plan.Subscriptions[0].OutputPath)
+	assert.Equal(t, filepath.Join(output, "Text och musik med Eric Schüldt"), plan.Subscriptions[1].OutputPath)
+
+	require.NoError(t, run(context.TODO(), configFilePath, subscriptionsFilePath))
+
+	assert.Equal(t, []string{
+		"Text och musik med Eric Schüldt",
+		"Text och musik med Eric Schüldt/Carpe diem.jpg",
+		"Text och musik med Eric Schüldt/Carpe diem.m4a",
+		"Text och musik med Eric Schüldt/backdrop.jpg",
+		"Text och musik med Eric Schüldt/cover.jpg",
+		"Varför låter en stråkkvartett som den gör?.jpg",
+		"Varför låter en stråkkvartett som den gör?.m4a",
+		"backdrop.jpg",
+		"cover.jpg",
+	}, tree(t, output))
+}
+
+func TestDryRun(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	output := t.TempDir()
+
+	// An already downloaded episode and an old file that would be removed
+	existingFilePath := filepath.Join(output, "Text och musik med Eric Schüldt", "Carpe diem.m4a")
+	require.NoError(t, os.MkdirAll(filepath.Dir(existingFilePath), os.ModePerm))
+	require.NoError(t, os.WriteFile(existingFilePath, []byte{}, 0644))
+
+	oldFilePath := filepath.Join(output, "Text och musik med Eric Schüldt", "Old", "Gammalt avsnitt.m4a")
+	require.NoError(t, os.MkdirAll(filepath.Dir(oldFilePath), os.ModePerm))
+	require.NoError(t, os.WriteFile(oldFilePath, []byte{}, 0644))
+	require.NoError(t, os.Chtimes(oldFilePath, time.Now(), time.Now().Add(-24*365*100*time.Hour)))
+
+	configFilePath := writeFile(t, "config.yaml", `
+output: `+output+`/{{.Program.Name}}
+logLevel: error
+presets:
+  default:
+    retention: 876000h
+    downloadRange: 876000h
+    throttling:
+      maxDownloadsPerProgram: 5
+      perSubscription: 1h
+`)
+
+	subscriptionsFilePath := writeFile(t, "subscriptions.yaml", `
+textochmusik:
+  programId: 4914
+  presets:
+    - default
+
+musikprofessorn:
+  programId: 5082
+  presets:
+    - default
+`)
+
+	before := tree(t, output)
+
+	plan, err := dryRun(context.TODO(), configFilePath, subscriptionsFilePath)
+	require.NoError(t, err)
+
+	expected := &Plan{
+		Subscriptions: []*SubscriptionPlan{
+			{
+				ID:          "musikprofessorn",
+				ProgramID:   5082,
+				ProgramName: "Musikprofessorn",
+				OutputPath:  filepath.Join(output, "Musikprofessorn"),
+				Downloads: []PlannedDownload{
+					{
+						EpisodeID: 2531337,
+						Title:     "Varför låter en stråkkvartett som den gör?",
+						URL:       server.URL + "/topsy/ljudfil/srapi/9893318.m4a",
+						Path:      filepath.Join(output, "Musikprofessorn", "Varför låter en stråkkvartett som den gör?.m4a"),
+					},
+				},
+				RemovedFiles:       []string{},
+				RemovedDirectories: []string{},
+			},
+			{
+				ID:          "textochmusik",
+				ProgramID:   4914,
+				ProgramName: "Text och musik med Eric Schüldt",
+				OutputPath:  filepath.Join(output, "Text och musik med Eric Schüldt"),
+				Downloads: []PlannedDownload{
+					{
+						EpisodeID: 2479556,
+						Title:     "Detta är skönheten",
+						URL:       server.URL + "/topsy/ljudfil/srapi/9512347.m4a",
+						Path:      filepath.Join(output, "Text och musik med Eric Schüldt", "Detta är skönheten.m4a"),
+					},
+				},
+				RemovedFiles:       []string{oldFilePath},
+				RemovedDirectories: []string{filepath.Dir(oldFilePath)},
+			},
+		},
+	}
+	assert.Equal(t, expected, plan)
+
+	// Nothing is downloaded or removed
+	assert.Equal(t, before, tree(t, output))
+}
+
+// useClient replaces [sr.DefaultClient] and [httputil.DefaultClient] with
+// client for the duration of the test.
+func useClient(t *testing.T, client *sr.Client) {
+	previous := sr.DefaultClient
+	previousHTTPClient := httputil.DefaultClient
+	sr.DefaultClient = client
+	httputil.DefaultClient = client.Client
+	t.Cleanup(func() {
+		sr.DefaultClient = previous
+		httputil.DefaultClient = previousHTTPClient
+	})
+}
+
+// writeFile writes content to a file in a temporary directory, returning its
+// path.
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+// tree returns the sorted relative paths of all files and directories in root.
+func tree(t *testing.T, root string) []string {
+	entries := make([]string, 0)
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p == root {
+			return nil
+		}
+
+		relative, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, filepath.ToSlash(relative))
+		return nil
+	})
+	require.NoError(t, err)
+
+	return entries
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/httputil"
+)
+
+// notifyTimeout is the maximum time to wait for a media server to respond.
+const notifyTimeout = 30 * time.Second
+
+// Notifiers contains configuration of media servers to notify after a run
+// that downloaded episodes.
+type Notifiers struct {
+	// Jellyfin configures refreshing Jellyfin libraries.
+	Jellyfin JellyfinNotifier `yaml:"jellyfin"`
+	// Audiobookshelf configures scanning Audiobookshelf libraries.
+	Audiobookshelf AudiobookshelfNotifier `yaml:"audiobookshelf"`
+}
+
+// JellyfinNotifier refreshes all Jellyfin libraries.
+type JellyfinNotifier struct {
+	// URL is the base URL of the Jellyfin server, such as
+	// "http://localhost:8096". The notifier is disabled unless set.
+	URL string `yaml:"url"`
+	// APIKey is a Jellyfin API key, created in the server's dashboard.
+	APIKey string `yaml:"apiKey"`
+}
+
+// Notify triggers a refresh of all Jellyfin libraries.
+func (n JellyfinNotifier) Notify(ctx context.Context) error {
+	// SEE: https://api.jellyfin.org/#tag/Library/operation/RefreshLibrary
+	return notify(ctx, strings.TrimSuffix(n.URL, "/")+"/Library/Refresh", `MediaBrowser Token="`+n.APIKey+`"`)
+}
+
+// AudiobookshelfNotifier scans Audiobookshelf libraries.
+type AudiobookshelfNotifier struct {
+	// URL is the base URL of the Audiobookshelf server, such as
+	// "http://localhost:13378". The notifier is disabled unless set.
+	URL string `yaml:"url"`
+	// APIKey is an Audiobookshelf API token.
+	APIKey string `yaml:"apiKey"`
+	// Libraries are the ids of the libraries to scan.
+	Libraries []string `yaml:"libraries"`
+}
+
+// Notify triggers a scan of the configured Audiobookshelf libraries.
+func (n AudiobookshelfNotifier) Notify(ctx context.Context) error {
+	if len(n.Libraries) == 0 {
+		return fmt.Errorf("no libraries configured")
+	}
+
+	var errs []error
+	for _, library := range n.Libraries {
+		// SEE: https://api.audiobookshelf.org/#scan-a-library-39-s-folders
+		endpoint := strings.TrimSuffix(n.URL, "/") + "/api/libraries/" + url.PathEscape(library) + "/scan"
+		if err := notify(ctx, endpoint, "Bearer "+n.APIKey); err != nil {
+			errs = append(errs, fmt.Errorf("library %s: %w", library, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// notify posts an empty request to endpoint, authorized by authorization.
+func notify(ctx context.Context, endpoint string, authorization string) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", authorization)
+
+	res, err := httputil.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// notifyMediaServers notifies all configured media servers. Failures are
+// logged rather than returned, as the episodes are already downloaded.
+func notifyMediaServers(ctx context.Context, config Notifiers) {
+	if config.Jellyfin.URL != "" {
+		log := slog.With(slog.String("notifier", "jellyfin"))
+		log.Debug("Refreshing libraries")
+		if err := config.Jellyfin.Notify(ctx); err != nil {
+			log.Warn("Failed to refresh libraries", slog.Any("error", err))
+			// Fallthrough
+		}
+	}
+
+	if config.Audiobookshelf.URL != "" {
+		log := slog.With(slog.String("notifier", "audiobookshelf"))
+		log.Debug("Scanning libraries")
+		if err := config.Audiobookshelf.Notify(ctx); err != nil {
+			log.Warn("Failed to scan libraries", slog.Any("error", err))
+			// Fallthrough
+		}
+	}
+}
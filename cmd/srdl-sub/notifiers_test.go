@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newMediaServer returns a stand-in for Jellyfin and Audiobookshelf, recording
+// authorized requests by method and path.
+func newMediaServer(t *testing.T) (*httptest.Server, *[]string) {
+	requests := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case `MediaBrowser Token="jellyfin-key"`, "Bearer audiobookshelf-key":
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/Library/Refresh":
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/libraries/podcasts/scan", "/api/libraries/audiobooks/scan":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		requests = append(requests, r.Method+" "+r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestJellyfinNotifier(t *testing.T) {
+	server, requests := newMediaServer(t)
+
+	notifier := JellyfinNotifier{URL: server.URL + "/", APIKey: "jellyfin-key"}
+	assert.NoError(t, notifier.Notify(context.TODO()))
+	assert.Equal(t, []string{"POST /Library/Refresh"}, *requests)
+
+	notifier.APIKey = "invalid"
+	assert.Error(t, notifier.Notify(context.TODO()))
+}
+
+func TestAudiobookshelfNotifier(t *testing.T) {
+	server, requests := newMediaServer(t)
+
+	notifier := AudiobookshelfNotifier{
+		URL:       server.URL,
+		APIKey:    "audiobookshelf-key",
+		Libraries: []string{"podcasts", "missing", "audiobooks"},
+	}
+	// Other libraries are scanned even if one fails
+	assert.Error(t, notifier.Notify(context.TODO()))
+	assert.Equal(t, []string{
+		"POST /api/libraries/podcasts/scan",
+		"POST /api/libraries/audiobooks/scan",
+	}, *requests)
+
+	notifier.Libraries = nil
+	assert.Error(t, notifier.Notify(context.TODO()))
+}
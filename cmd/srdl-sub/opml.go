@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/opml"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/goccy/go-yaml"
+)
+
+// exportOPMLCommand is the entrypoint of the "export-opml" command.
+func exportOPMLCommand(ctx context.Context, args []string) error {
+	commandLine := flag.NewFlagSet(os.Args[0]+" export-opml", flag.ExitOnError)
+
+	subscriptionsFilePath := commandLine.String("subscriptions", "", "Subscriptions file path")
+	outputFilePath := commandLine.String("output", "", "Output file path, defaults to stdout")
+	commandLine.Parse(args)
+
+	if *subscriptionsFilePath == "" {
+		commandLine.Usage()
+		os.Exit(1)
+	}
+
+	var subscriptions map[string]Subscription
+	if err := readYamlFromFile(*subscriptionsFilePath, &subscriptions); err != nil {
+		return err
+	}
+
+	document, err := exportOPML(ctx, subscriptions)
+	if err != nil {
+		return err
+	}
+
+	if *outputFilePath == "" {
+		return document.Write(os.Stdout)
+	}
+
+	file, err := os.Create(*outputFilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := document.Write(file); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// exportOPML returns an OPML document containing the RSS feed of each
+// subscribed program, for use with podcast apps.
+func exportOPML(ctx context.Context, subscriptions map[string]Subscription) (*opml.Document, error) {
+	resolved, resolveErrors, err := resolveSubscriptions(ctx, subscriptions, newProgramIDCache(""))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resolveErrors) > 0 {
+		errs := make([]error, 0, len(resolveErrors))
+		for _, subscriptionID := range slices.Sorted(maps.Keys(resolveErrors)) {
+			errs = append(errs, fmt.Errorf("%s: %w", subscriptionID, resolveErrors[subscriptionID]))
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	document := &opml.Document{
+		Head: opml.Head{
+			Title:       "Sveriges Radio subscriptions",
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	exported := make(map[int]bool)
+	for _, subscriptionID := range slices.Sorted(maps.Keys(resolved)) {
+		programID := resolved[subscriptionID].ProgramID
+		if exported[programID] {
+			continue
+		}
+		exported[programID] = true
+
+		log := slog.With(slog.String("subscription", subscriptionID), slog.Int("programId", programID))
+		program, err := retryIfRateLimited(ctx, log, func() (*sr.Program, error) {
+			return sr.DefaultClient.GetProgram(ctx, programID)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to get program: %w", subscriptionID, err)
+		}
+
+		pageURL := program.URL
+		if program.Slug != "" {
+			pageURL = sr.DefaultClient.ProgramPageURL(program.Slug)
+		}
+
+		document.Body.Outlines = append(document.Body.Outlines, opml.Outline{
+			Text:    program.Name,
+			Title:   program.Name,
+			Type:    "rss",
+			XMLURL:  sr.DefaultClient.ProgramFeedURL(program.ID),
+			HTMLURL: pageURL,
+		})
+	}
+
+	return document, nil
+}
+
+// importOPMLCommand is the entrypoint of the "import-opml" command.
+func importOPMLCommand(ctx context.Context, args []string) error {
+	commandLine := flag.NewFlagSet(os.Args[0]+" import-opml", flag.ExitOnError)
+	commandLine.Usage = func() {
+		fmt.Fprintf(commandLine.Output(), "usage: %s import-opml [options...] <file>\n\noptions:\n", os.Args[0])
+		commandLine.PrintDefaults()
+	}
+
+	presets := commandLine.String("presets", "", "Comma-separated presets to use for the imported subscriptions")
+	commandLine.Parse(args)
+
+	if commandLine.NArg() != 1 {
+		commandLine.Usage()
+		os.Exit(1)
+	}
+
+	file, err := os.Open(commandLine.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	document, err := opml.Read(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse opml: %w", err)
+	}
+
+	var presetNames []string
+	if *presets != "" {
+		presetNames = strings.Split(*presets, ",")
+	}
+
+	subscriptions, err := importOPML(ctx, document, presetNames, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	return yaml.NewEncoder(os.Stdout).Encode(subscriptions)
+}
+
+// importOPML returns a subscription for each of SR's programs in document,
+// using presets. Subscriptions are identified by the program's slug. Feeds
+// that are not SR's or that cannot be resolved to a program are reported to
+// w and skipped.
+func importOPML(ctx context.Context, document *opml.Document, presets []string, w io.Writer) (map[string]Subscription, error) {
+	subscriptions := make(map[string]Subscription)
+	imported := make(map[int]bool)
+
+	for _, feed := range document.Feeds() {
+		if !sr.DefaultClient.IsFeedURL(feed.XMLURL) {
+			fmt.Fprintf(w, "Skipping %q, %s is not a feed of Sveriges Radio\n", feed.Text, feed.XMLURL)
+			continue
+		}
+
+		log := slog.With(slog.String("url", feed.XMLURL))
+		programID, err := retryIfRateLimited(ctx, log, func() (int, error) {
+			return sr.DefaultClient.GetProgramIDFromFeed(ctx, feed.XMLURL)
+		})
+		if errors.Is(err, sr.ErrBlocked) {
+			return nil, err
+		} else if err != nil {
+			fmt.Fprintf(w, "Skipping %q, failed to identify program: %v\n", feed.Text, err)
+			continue
+		}
+
+		if imported[programID] {
+			continue
+		}
+		imported[programID] = true
+
+		program, err := retryIfRateLimited(ctx, log, func() (*sr.Program, error) {
+			return sr.DefaultClient.GetProgram(ctx, programID)
+		})
+		if errors.Is(err, sr.ErrBlocked) {
+			return nil, err
+		} else if err != nil {
+			fmt.Fprintf(w, "Skipping %q, failed to get program %d: %v\n", feed.Text, programID, err)
+			continue
+		}
+
+		subscriptionID := program.Slug
+		if subscriptionID == "" {
+			subscriptionID = "program" + strconv.Itoa(program.ID)
+		}
+
+		subscriptions[subscriptionID] = Subscription{
+			ProgramID: program.ID,
+			Presets:   presets,
+		}
+	}
+
+	return subscriptions, nil
+}
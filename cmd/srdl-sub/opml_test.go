@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/AlexGustafsson/srdl/internal/opml"
+	"github.com/AlexGustafsson/srdl/internal/sr/srtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportOPML(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	document, err := exportOPML(context.TODO(), map[string]Subscription{
+		"textochmusik": {Slug: "textochmusikmedericschuldt"},
+		"musikprofessorn": {
+			ProgramID: 5082,
+			Presets:   []string{"throttle"},
+		},
+		// Duplicates are only exported once
+		"duplicate": {ProgramID: 5082},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []opml.Outline{
+		{
+			Text:    "Musikprofessorn",
+			Title:   "Musikprofessorn",
+			Type:    "rss",
+			XMLURL:  server.URL + "/api/rss/program/5082",
+			HTMLURL: server.URL + "/musikprofessorn",
+		},
+		{
+			Text:    "Text och musik med Eric Schüldt",
+			Title:   "Text och musik med Eric Schüldt",
+			Type:    "rss",
+			XMLURL:  server.URL + "/api/rss/program/4914",
+			HTMLURL: server.URL + "/textochmusikmedericschuldt",
+		},
+	}, document.Body.Outlines)
+
+	_, err = exportOPML(context.TODO(), map[string]Subscription{
+		"removed": {Slug: "removed"},
+	})
+	assert.ErrorContains(t, err, "removed: program page")
+}
+
+func TestImportOPML(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	server.SetFile("/api/rss/pod/22185", "application/rss+xml; charset=utf-8", []byte(`<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0">
+	<channel>
+		<title>Musikprofessorn</title>
+		<link>https://sverigesradio.se/default.aspx?programid=5082</link>
+	</channel>
+</rss>`))
+
+	document, err := opml.Read(strings.NewReader(`<?xml version="1.0" encoding="utf-8"?>
+<opml version="2.0">
+	<body>
+		<outline text="Musik">
+			<outline type="rss" text="Musikprofessorn" xmlUrl="` + server.URL + `/api/rss/pod/22185" />
+		</outline>
+		<outline type="rss" text="Text och musik" xmlUrl="` + server.URL + `/api/rss/program/4914" />
+		<outline type="rss" text="Other podcast" xmlUrl="https://example.com/feed.xml" />
+		<outline type="rss" text="Missing" xmlUrl="` + server.URL + `/api/rss/pod/1" />
+	</body>
+</opml>`))
+	require.NoError(t, err)
+
+	var output strings.Builder
+	subscriptions, err := importOPML(context.TODO(), document, []string{"throttle"}, &output)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]Subscription{
+		"musikprofessorn": {
+			ProgramID: 5082,
+			Presets:   []string{"throttle"},
+		},
+		"textochmusikmedericschuldt": {
+			ProgramID: 4914,
+			Presets:   []string{"throttle"},
+		},
+	}, subscriptions)
+
+	assert.Contains(t, output.String(), `Skipping "Other podcast", https://example.com/feed.xml is not a feed of Sveriges Radio`)
+	assert.Contains(t, output.String(), `Skipping "Missing", failed to identify program`)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Plan describes what a run would do, without downloading or removing
+// anything.
+type Plan struct {
+	Subscriptions []*SubscriptionPlan `json:"subscriptions"`
+}
+
+// SubscriptionPlan describes what a run would do for a single subscription.
+type SubscriptionPlan struct {
+	ID          string `json:"id"`
+	ProgramID   int    `json:"programId"`
+	ProgramName string `json:"programName,omitempty"`
+	OutputPath  string `json:"outputPath,omitempty"`
+	// Downloads are the episodes that would be downloaded.
+	Downloads []PlannedDownload `json:"downloads"`
+	// RemovedFiles are the files that would be removed due to retention.
+	RemovedFiles []string `json:"removedFiles"`
+	// RemovedDirectories are the empty directories that would be removed.
+	RemovedDirectories []string `json:"removedDirectories"`
+	// Error describes why the subscription could not be planned.
+	Error string `json:"error,omitempty"`
+}
+
+// PlannedDownload describes an episode that would be downloaded.
+type PlannedDownload struct {
+	EpisodeID int    `json:"episodeId"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	// Path is the path the episode would be written to. If the extension can
+	// only be determined by downloading the episode, the path has none.
+	Path string `json:"path"`
+}
+
+// NewSubscriptionPlan returns an empty plan for a subscription.
+func NewSubscriptionPlan(id string, subscription Subscription) *SubscriptionPlan {
+	return &SubscriptionPlan{
+		ID:                 id,
+		ProgramID:          subscription.ProgramID,
+		Downloads:          make([]PlannedDownload, 0),
+		RemovedFiles:       make([]string, 0),
+		RemovedDirectories: make([]string, 0),
+	}
+}
+
+// WriteText writes a human-readable description of the plan to w.
+func (p *Plan) WriteText(w io.Writer) error {
+	var builder strings.Builder
+
+	for i, subscription := range p.Subscriptions {
+		if i > 0 {
+			builder.WriteString("\n")
+		}
+
+		fmt.Fprintf(&builder, "Subscription %s (program %d", subscription.ID, subscription.ProgramID)
+		if subscription.ProgramName != "" {
+			fmt.Fprintf(&builder, ", %s", subscription.ProgramName)
+		}
+		builder.WriteString(")\n")
+
+		if subscription.OutputPath != "" {
+			fmt.Fprintf(&builder, "  Output: %s\n", subscription.OutputPath)
+		}
+
+		if subscription.Error != "" {
+			fmt.Fprintf(&builder, "  Error: %s\n", subscription.Error)
+		}
+
+		if len(subscription.Downloads) == 0 && len(subscription.RemovedFiles) == 0 && len(subscription.RemovedDirectories) == 0 && subscription.Error == "" {
+			builder.WriteString("  Nothing to do\n")
+		}
+
+		for _, download := range subscription.Downloads {
+			fmt.Fprintf(&builder, "  Download: %s (episode %d) -> %s\n", download.Title, download.EpisodeID, download.Path)
+		}
+
+		for _, path := range subscription.RemovedFiles {
+			fmt.Fprintf(&builder, "  Remove file: %s\n", path)
+		}
+
+		for _, path := range subscription.RemovedDirectories {
+			fmt.Fprintf(&builder, "  Remove directory: %s\n", path)
+		}
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// WriteJSON writes the plan as indented JSON to w.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p)
+}
+
+// sortSubscriptions sorts the subscriptions by id, for stable output.
+func (p *Plan) sortSubscriptions() {
+	slices.SortFunc(p.Subscriptions, func(a *SubscriptionPlan, b *SubscriptionPlan) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+}
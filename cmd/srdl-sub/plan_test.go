@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanWriteText(t *testing.T) {
+	plan := &Plan{
+		Subscriptions: []*SubscriptionPlan{
+			{
+				ID:          "musikprofessorn",
+				ProgramID:   5082,
+				ProgramName: "Musikprofessorn",
+				OutputPath:  "output/Musikprofessorn",
+				Downloads: []PlannedDownload{
+					{
+						EpisodeID: 2531337,
+						Title:     "Varför låter en stråkkvartett som den gör?",
+						Path:      "output/Musikprofessorn/Varför låter en stråkkvartett som den gör?.m4a",
+					},
+				},
+				RemovedFiles:       []string{"output/Musikprofessorn/Old/Gammalt avsnitt.m4a"},
+				RemovedDirectories: []string{"output/Musikprofessorn/Old"},
+			},
+			NewSubscriptionPlan("textochmusik", Subscription{ProgramID: 4914}),
+			{
+				ID:        "missing",
+				ProgramID: 1,
+				Error:     "preset not found",
+			},
+		},
+	}
+
+	var builder strings.Builder
+	require.NoError(t, plan.WriteText(&builder))
+
+	expected := `Subscription musikprofessorn (program 5082, Musikprofessorn)
+  Output: output/Musikprofessorn
+  Download: Varför låter en stråkkvartett som den gör? (episode 2531337) -> output/Musikprofessorn/Varför låter en stråkkvartett som den gör?.m4a
+  Remove file: output/Musikprofessorn/Old/Gammalt avsnitt.m4a
+  Remove directory: output/Musikprofessorn/Old
+
+Subscription textochmusik (program 4914)
+  Nothing to do
+
+Subscription missing (program 1)
+  Error: preset not found
+`
+	assert.Equal(t, expected, builder.String())
+}
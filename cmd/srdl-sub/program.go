@@ -2,32 +2,41 @@ package main
 
 import (
 	"context"
+	"errors"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/AlexGustafsson/srdl/internal/fsutil"
 	"github.com/AlexGustafsson/srdl/internal/httputil"
 	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/AlexGustafsson/srdl/internal/state"
 )
 
 // processProgram processes a single program.
-func processProgram(ctx context.Context, subscription Subscription, config Preset, log *slog.Logger) error {
+// Returns the number of downloaded episodes, which are recorded in state. If
+// plan is set, nothing is downloaded or removed, but added to plan.
+func processProgram(ctx context.Context, subscription Subscription, config Preset, store *state.Store, plan *SubscriptionPlan, log *slog.Logger) (int, error) {
 	log.Debug("Processing program")
 
-	program, err := sr.DefaultClient.GetProgram(ctx, subscription.ProgramID)
-	if err == sr.ErrNotFound {
+	program, err := retryIfRateLimited(ctx, log, func() (*sr.Program, error) {
+		return sr.DefaultClient.GetProgram(ctx, subscription.ProgramID)
+	})
+	if errors.Is(err, sr.ErrNotFound) {
 		log.Warn("Program not found", slog.Any("error", err))
 		// Don't let the error fail other subscriptions
-		return nil
+		return 0, nil
 	} else if err != nil {
 		log.Error("Failed to get program", slog.Any("error", err))
-		return err
+		return 0, err
 	}
 
 	// Resolve the output path to use based on config and data about the program
-	outputPath, err := renderOutputPathTemplate(config.Output, TemplateValues{
+	values := TemplateValues{
 		Subscription: SubscriptionTemplateValues{
 			Artist: subscription.Artist,
 			Album:  subscription.Album,
@@ -35,21 +44,33 @@ func processProgram(ctx context.Context, subscription Subscription, config Prese
 		Program: ProgramTemplateValues{
 			Name: program.Name,
 		},
-	})
+	}
+	outputPath, err := renderOutputPathTemplate(config.Output, values)
 	if err != nil {
 		log.Error("Failed to determine output path", slog.Any("error", err))
-		return err
+		return 0, err
 	}
-	if err := os.MkdirAll(outputPath, os.ModePerm); err != nil {
-		return err
+
+	// Each selected program is output to its own directory, so that programs
+	// don't replace each other's images or remove each other's episodes
+	if subscription.Programs != nil && isSharedOutputPathTemplate(config.Output, values) {
+		outputPath = filepath.Join(outputPath, program.Name)
+	}
+	if plan != nil {
+		plan.ProgramName = program.Name
+		plan.OutputPath = outputPath
+	} else if err := os.MkdirAll(outputPath, os.ModePerm); err != nil {
+		return 0, err
 	}
 	log = log.With(slog.String("outputPath", outputPath))
 
 	// TODO: Paginate through all episodes?
-	result, err := sr.DefaultClient.ListEpisodesInProgram(ctx, subscription.ProgramID, nil)
+	result, err := retryIfRateLimited(ctx, log, func() (*sr.EpisodesPage, error) {
+		return sr.DefaultClient.ListEpisodesInProgram(ctx, subscription.ProgramID, nil)
+	})
 	if err != nil {
 		log.Error("Failed to list episodes in program", slog.Any("error", err))
-		return err
+		return 0, err
 	}
 
 	downloads := 0
@@ -57,7 +78,7 @@ func processProgram(ctx context.Context, subscription Subscription, config Prese
 		log := log.With(slog.Int("episodeId", episode.ID))
 
 		if err := ctx.Err(); err != nil {
-			return err
+			return downloads, err
 		}
 
 		if downloads >= config.Throttling.MaxDownloadsPerProgram {
@@ -65,34 +86,66 @@ func processProgram(ctx context.Context, subscription Subscription, config Prese
 			break
 		}
 
-		if config.Throttling.EpisodeDelay > 0 {
+		if config.Throttling.EpisodeDelay > 0 && plan == nil {
 			log.Debug("Waiting before proceeding with processing episode", slog.Duration("delay", config.Throttling.EpisodeDelay))
 			select {
 			case <-ctx.Done():
-				return ctx.Err()
+				return downloads, ctx.Err()
 			case <-time.After(config.Throttling.EpisodeDelay):
 			}
 		}
 
-		didDownload, err := processEpisode(ctx, episode, config, outputPath, log)
+		path, didDownload, err := processEpisode(ctx, episode, program, config, outputPath, store, plan, log)
 		if err != nil {
 			if err != ctx.Err() {
 				log.Error("Failed to process episode", slog.Any("error", err))
+
+				// Only report failed downloads, not episodes that can't be downloaded
+				if path != "" && plan == nil {
+					runHooks(ctx, config.Hooks, HookPayload{
+						Event:   HookEventFailed,
+						Path:    path,
+						Episode: &episode,
+						Program: program,
+						Error:   err.Error(),
+					}, log)
+				}
 			}
 			continue
 		}
 
 		if didDownload {
 			downloads++
+			if plan != nil {
+				continue
+			}
+
+			runHooks(ctx, config.Hooks, HookPayload{
+				Event:   HookEventDownloaded,
+				Path:    path,
+				Episode: &episode,
+				Program: program,
+			}, log)
 		}
 	}
 
-	if err := httputil.DownloadIfNotExist(ctx, filepath.Join(outputPath, "cover"), program.ImageURL); err != nil {
+	if plan != nil {
+		planRetention(config, outputPath, plan, log)
+		return downloads, nil
+	}
+
+	coverURL := program.ImageURL
+	if config.Images.CoverPreset != "" {
+		coverURL = sr.ImageURL(program.ImageTemplateURL, config.Images.CoverPreset)
+	}
+
+	if err := httputil.DownloadOrRefresh(ctx, filepath.Join(outputPath, "cover"), coverURL, config.Images.RefreshInterval); err != nil {
 		log.Warn("Failed to download cover image", slog.Any("error", err))
 		// Fallthrough
 	}
 
-	if err := httputil.DownloadIfNotExist(ctx, filepath.Join(outputPath, "backdrop"), program.ImageTemplateWideURL); err != nil {
+	backdropURL := sr.ImageURL(program.ImageTemplateWideURL, config.Images.BackdropPreset)
+	if err := httputil.DownloadOrRefresh(ctx, filepath.Join(outputPath, "backdrop"), backdropURL, config.Images.RefreshInterval); err != nil {
 		log.Warn("Failed to download backdrop image", slog.Any("error", err))
 		// Fallthrough
 	}
@@ -101,10 +154,24 @@ func processProgram(ctx context.Context, subscription Subscription, config Prese
 	if config.Retention > 0 {
 		maxAge := time.Now().Add(-config.Retention)
 		log.Debug("Removing old files", slog.Time("maxAge", maxAge))
-		if err := fsutil.RemoveOldFiles(outputPath, maxAge); err != nil {
+		removed, err := fsutil.RemoveOldFiles(outputPath, maxAge)
+		if err != nil {
 			log.Warn("Failed to clean up old files", slog.Any("error", err))
 			// Fallthrough
 		}
+
+		for _, path := range removed {
+			// Images and their metadata are removed alongside episodes
+			if !slices.Contains(audioExtensions, strings.ToLower(filepath.Ext(path))) {
+				continue
+			}
+
+			runHooks(ctx, config.Hooks, HookPayload{
+				Event:   HookEventRemoved,
+				Path:    path,
+				Program: program,
+			}, log)
+		}
 	}
 
 	// Try to remove empty directories
@@ -114,5 +181,26 @@ func processProgram(ctx context.Context, subscription Subscription, config Prese
 		// Fallthrough
 	}
 
-	return nil
+	return downloads, nil
+}
+
+// planRetention adds the files and directories that would be removed from
+// outputPath to plan.
+func planRetention(config Preset, outputPath string, plan *SubscriptionPlan, log *slog.Logger) {
+	if config.Retention > 0 {
+		maxAge := time.Now().Add(-config.Retention)
+		files, err := fsutil.OldFiles(outputPath, maxAge)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Warn("Failed to identify old files", slog.Any("error", err))
+			// Fallthrough
+		}
+		plan.RemovedFiles = append(plan.RemovedFiles, files...)
+	}
+
+	dirs, err := fsutil.EmptyDirectories(outputPath, plan.RemovedFiles...)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warn("Failed to identify empty directories", slog.Any("error", err))
+		// Fallthrough
+	}
+	plan.RemovedDirectories = append(plan.RemovedDirectories, dirs...)
 }
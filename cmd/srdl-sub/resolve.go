@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/fsutil"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+)
+
+// programIDMaxAge is the time a resolved program id is used before the
+// program's page is resolved again, to notice slugs that no longer resolve.
+const programIDMaxAge = 7 * 24 * time.Hour
+
+// programIDCache caches program ids resolved from program pages.
+type programIDCache struct {
+	// path is the path to the file the cache is persisted to. The cache is
+	// only kept in memory unless set.
+	path    string
+	entries map[string]programIDCacheEntry
+}
+
+type programIDCacheEntry struct {
+	ProgramID  int       `json:"programId"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+}
+
+// newProgramIDCache returns a cache persisted to path, if set. An invalid or
+// missing file results in an empty cache.
+func newProgramIDCache(path string) *programIDCache {
+	cache := &programIDCache{
+		path:    path,
+		entries: make(map[string]programIDCacheEntry),
+	}
+
+	if path != "" {
+		if content, err := os.ReadFile(path); err == nil {
+			// Ignore invalid caches, they will be replaced
+			json.Unmarshal(content, &cache.entries)
+		}
+	}
+
+	return cache
+}
+
+// save persists the cache, if configured to.
+func (c *programIDCache) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(c.path, bytes.NewReader(content), 0644)
+}
+
+// resolveSubscriptions resolves the program id of each subscription.
+// Subscriptions selecting multiple programs are replaced by one subscription
+// per program, identified as "<subscription>/<program id>", which keeps the
+// selector. Programs that are explicitly subscribed to are never selected by
+// other subscriptions.
+//
+// Returns the resolved subscriptions and errors of subscriptions that could not
+// be resolved, which are kept as is in the resolved subscriptions. An error is
+// only returned if requests are blocked by SR.
+func resolveSubscriptions(ctx context.Context, subscriptions map[string]Subscription, cache *programIDCache) (map[string]Subscription, map[string]error, error) {
+	resolved := make(map[string]Subscription)
+	resolveErrors := make(map[string]error)
+	subscribed := make(map[int]bool)
+
+	for _, subscriptionID := range slices.Sorted(maps.Keys(subscriptions)) {
+		subscription := subscriptions[subscriptionID]
+		if subscription.Programs != nil {
+			continue
+		}
+
+		log := slog.With(slog.String("subscription", subscriptionID))
+		programID, err := resolveProgramID(ctx, subscription, cache, log)
+		if errors.Is(err, sr.ErrBlocked) {
+			log.Error("Requests are blocked by SR, aborting", slog.Any("error", err))
+			return nil, nil, err
+		} else if err != nil {
+			resolved[subscriptionID] = subscription
+			resolveErrors[subscriptionID] = err
+			continue
+		}
+
+		subscription.ProgramID = programID
+		resolved[subscriptionID] = subscription
+		subscribed[programID] = true
+	}
+
+	if err := cache.save(); err != nil {
+		slog.Warn("Failed to cache resolved program ids", slog.Any("error", err))
+		// Fallthrough
+	}
+
+	for _, subscriptionID := range slices.Sorted(maps.Keys(subscriptions)) {
+		subscription := subscriptions[subscriptionID]
+		if subscription.Programs == nil {
+			continue
+		}
+
+		log := slog.With(slog.String("subscription", subscriptionID))
+		programs, err := selectPrograms(ctx, *subscription.Programs, log)
+		if errors.Is(err, sr.ErrBlocked) {
+			log.Error("Requests are blocked by SR, aborting", slog.Any("error", err))
+			return nil, nil, err
+		} else if err != nil {
+			resolved[subscriptionID] = subscription
+			resolveErrors[subscriptionID] = err
+			continue
+		}
+
+		log.Debug("Selected programs", slog.Int("programs", len(programs)))
+		for _, program := range programs {
+			if subscribed[program.ID] {
+				log.Debug("Skipping program that is already subscribed to", slog.Int("programId", program.ID))
+				continue
+			}
+
+			selected := subscription
+			selected.ProgramID = program.ID
+			resolved[subscriptionID+"/"+strconv.Itoa(program.ID)] = selected
+			subscribed[program.ID] = true
+		}
+	}
+
+	return resolved, resolveErrors, nil
+}
+
+// selectPrograms returns all programs in SR's programs index that are
+// selected by selector.
+func selectPrograms(ctx context.Context, selector ProgramSelector, log *slog.Logger) ([]sr.Program, error) {
+	if selector.ChannelID == 0 && selector.CategoryID == 0 && selector.NamePattern == "" {
+		return nil, fmt.Errorf("no channel, category or name pattern specified")
+	}
+
+	var namePattern *regexp.Regexp
+	if selector.NamePattern != "" {
+		var err error
+		namePattern, err = regexp.Compile(selector.NamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name pattern: %w", err)
+		}
+	}
+
+	programs := make([]sr.Program, 0)
+	for page := 1; ; page++ {
+		result, err := retryIfRateLimited(ctx, log, func() (*sr.ProgramsPage, error) {
+			return sr.DefaultClient.ListPrograms(ctx, &sr.ListProgramsOptions{
+				Page:       page,
+				PageSize:   100,
+				ChannelID:  selector.ChannelID,
+				CategoryID: selector.CategoryID,
+			})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list programs: %w", err)
+		}
+
+		for _, program := range result.Programs {
+			if program.Archived && !selector.IncludeArchived {
+				continue
+			}
+
+			if namePattern != nil && !namePattern.MatchString(program.Name) {
+				continue
+			}
+
+			programs = append(programs, program)
+		}
+
+		if page >= result.Pagination.TotalPages || len(result.Programs) == 0 {
+			break
+		}
+	}
+
+	return programs, nil
+}
+
+// ProgramPageURL returns the URL of the subscription's program page, if the
+// program is identified by its URL or slug rather than its id.
+func (s Subscription) ProgramPageURL() string {
+	if s.URL != "" {
+		return s.URL
+	}
+
+	if s.Slug != "" {
+		return sr.DefaultClient.ProgramPageURL(s.Slug)
+	}
+
+	return ""
+}
+
+// resolveProgramID returns the id of the subscription's program. Programs
+// identified by their URL or slug are resolved using their program page.
+func resolveProgramID(ctx context.Context, subscription Subscription, cache *programIDCache, log *slog.Logger) (int, error) {
+	if subscription.ProgramID > 0 {
+		return subscription.ProgramID, nil
+	}
+
+	pageURL := subscription.ProgramPageURL()
+	if pageURL == "" {
+		return 0, fmt.Errorf("no program id, url or slug specified")
+	}
+
+	cached, isCached := cache.entries[pageURL]
+	if isCached && time.Since(cached.ResolvedAt) < programIDMaxAge {
+		return cached.ProgramID, nil
+	}
+
+	log.Debug("Resolving program id", slog.String("url", pageURL))
+	programID, err := retryIfRateLimited(ctx, log, func() (int, error) {
+		return sr.DefaultClient.GetProgramID(ctx, pageURL)
+	})
+	if errors.Is(err, sr.ErrNotFound) || errors.Is(err, sr.ErrProgramIDNotFound) {
+		// Don't fall back to the cached id, the program may have been replaced
+		return 0, fmt.Errorf("program page %s no longer resolves to a program, update the subscription: %w", pageURL, err)
+	} else if err != nil {
+		if isCached {
+			log.Warn("Failed to resolve program id, using previously resolved id", slog.Any("error", err))
+			return cached.ProgramID, nil
+		}
+
+		return 0, fmt.Errorf("failed to resolve program id of %s: %w", pageURL, err)
+	}
+
+	cache.entries[pageURL] = programIDCacheEntry{
+		ProgramID:  programID,
+		ResolvedAt: time.Now(),
+	}
+
+	return programID, nil
+}
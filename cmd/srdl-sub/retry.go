@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/sr"
+)
+
+const (
+	// maxRateLimitedAttempts is the maximum number of times to attempt a
+	// request that is rate limited.
+	maxRateLimitedAttempts = 3
+	// defaultRateLimitDelay is the delay before retrying a rate limited request
+	// if the server doesn't specify one.
+	defaultRateLimitDelay = 30 * time.Second
+	// maxRateLimitDelay is the maximum delay before retrying a rate limited
+	// request.
+	maxRateLimitDelay = 5 * time.Minute
+)
+
+// retryIfRateLimited calls f until it succeeds, fails with an error that is
+// not [sr.ErrRateLimited] or has been called [maxRateLimitedAttempts] times.
+func retryIfRateLimited[T any](ctx context.Context, log *slog.Logger, f func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := f()
+		if err == nil || !errors.Is(err, sr.ErrRateLimited) || attempt >= maxRateLimitedAttempts {
+			return result, err
+		}
+
+		delay := defaultRateLimitDelay
+		var apiErr *sr.APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			delay = min(apiErr.RetryAfter, maxRateLimitDelay)
+		}
+
+		log.Warn("Rate limited, waiting before retrying", slog.Duration("delay", delay), slog.Int("attempt", attempt))
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryIfRateLimited(t *testing.T) {
+	rateLimited := &sr.APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Millisecond}
+	notFound := &sr.APIError{StatusCode: http.StatusNotFound}
+
+	testCases := []struct {
+		Name             string
+		Errors           []error
+		ExpectedAttempts int
+		ExpectedError    error
+	}{
+		{
+			Name:             "Success",
+			Errors:           []error{nil},
+			ExpectedAttempts: 1,
+		},
+		{
+			Name:             "Success after rate limit",
+			Errors:           []error{rateLimited, nil},
+			ExpectedAttempts: 2,
+		},
+		{
+			Name:             "Other errors are not retried",
+			Errors:           []error{notFound},
+			ExpectedAttempts: 1,
+			ExpectedError:    sr.ErrNotFound,
+		},
+		{
+			Name:             "Gives up",
+			Errors:           []error{rateLimited, rateLimited, rateLimited, nil},
+			ExpectedAttempts: maxRateLimitedAttempts,
+			ExpectedError:    sr.ErrRateLimited,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			attempts := 0
+			_, err := retryIfRateLimited(context.TODO(), slog.Default(), func() (int, error) {
+				err := testCase.Errors[attempts]
+				attempts++
+				return attempts, err
+			})
+
+			assert.Equal(t, testCase.ExpectedAttempts, attempts)
+			if testCase.ExpectedError == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, testCase.ExpectedError)
+			}
+		})
+	}
+}
@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"log/slog"
 	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/state"
 )
 
 // processSubscription processes a single subscription.
-func processSubscription(ctx context.Context, config Config, subscription Subscription, log *slog.Logger) error {
+// Returns the number of downloaded episodes, which are recorded in state. If
+// plan is set, nothing is downloaded or removed, but added to plan.
+func processSubscription(ctx context.Context, config Config, subscription Subscription, store *state.Store, plan *SubscriptionPlan, log *slog.Logger) (int, error) {
 	// Resolve the final config to use
 	appliedConfig := Preset{
 		Output: config.Output,
@@ -17,28 +21,32 @@ func processSubscription(ctx context.Context, config Config, subscription Subscr
 		preset, ok := config.Presets[presetName]
 		if !ok {
 			log.Error("No such preset", slog.String("preset", presetName))
-			return fmt.Errorf("preset not found")
+			return 0, fmt.Errorf("preset not found")
 		}
 
 		appliedConfig = appliedConfig.Apply(preset)
 	}
 	log.Debug("Resolved config", slog.Any("appliedConfig", appliedConfig))
 
-	log.Debug("Waiting before proceeding with processing subscription", slog.Duration("delay", appliedConfig.Throttling.SubscriptionDelay))
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-time.After(appliedConfig.Throttling.SubscriptionDelay):
+	// Dry runs only fetch metadata, so there's no need to throttle
+	if plan == nil {
+		log.Debug("Waiting before proceeding with processing subscription", slog.Duration("delay", appliedConfig.Throttling.SubscriptionDelay))
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(appliedConfig.Throttling.SubscriptionDelay):
+		}
 	}
 
 	log.Info("Processing subscription")
 
-	if err := processProgram(ctx, subscription, appliedConfig, log); err != nil {
+	downloads, err := processProgram(ctx, subscription, appliedConfig, store, plan, log)
+	if err != nil {
 		if err != ctx.Err() {
 			log.Error("Failed to process program", slog.Any("error", err))
 		}
-		return err
+		return downloads, err
 	}
 
-	return nil
+	return downloads, nil
 }
@@ -33,3 +33,21 @@ func renderOutputPathTemplate(template string, values TemplateValues) (string, e
 
 	return buffer.String(), nil
 }
+
+// isSharedOutputPathTemplate returns whether or not the templated path
+// renders the same for all programs, such as when it doesn't use
+// {{.Program.Name}}.
+func isSharedOutputPathTemplate(template string, values TemplateValues) bool {
+	outputPath, err := renderOutputPathTemplate(template, values)
+	if err != nil {
+		return false
+	}
+
+	values.Program.Name += " (other program)"
+	otherOutputPath, err := renderOutputPathTemplate(template, values)
+	if err != nil {
+		return false
+	}
+
+	return outputPath == otherOutputPath
+}
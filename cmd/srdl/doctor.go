@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/sr"
+)
+
+// doctorProgramIDs are the programs probed by default. They cover both
+// broadcasts and pods.
+var doctorProgramIDs = []int{
+	// Text och musik med Eric Schüldt (broadcast)
+	4914,
+	// P4 Retro (broadcast)
+	3260,
+	// Musikprofessorn (pod)
+	5082,
+}
+
+// doctorFinding is a schema difference found by the doctor, with the number of
+// times it was seen.
+type doctorFinding struct {
+	sr.SchemaWarning
+	Count int `json:"count"`
+}
+
+// doctorReport summarizes the result of probing the SR APIs.
+type doctorReport struct {
+	Findings []doctorFinding `json:"findings"`
+	Errors   []string        `json:"errors"`
+}
+
+func doctor(args []string) error {
+	commandLine := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+	programIDs := make([]int, 0)
+	commandLine.Func("program-id", "Program ID to probe. May be specified more than once", func(value string) error {
+		id, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return err
+		}
+
+		programIDs = append(programIDs, int(id))
+		return nil
+	})
+	outputJSON := commandLine.Bool("json", false, "Output the report as JSON")
+	commandLine.Usage = printUsage
+	commandLine.Parse(args)
+
+	if len(programIDs) == 0 {
+		programIDs = doctorProgramIDs
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	report := probePrograms(ctx, programIDs)
+
+	if *outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(&report); err != nil {
+			return err
+		}
+	} else {
+		printDoctorReport(report, programIDs)
+	}
+
+	return report.Err()
+}
+
+// probePrograms probes all endpoints used by srdl using the programs,
+// reporting any schema differences and errors.
+func probePrograms(ctx context.Context, programIDs []int) doctorReport {
+	counts := make(map[sr.SchemaWarning]int)
+	client := &sr.Client{
+		BaseURL:    sr.DefaultClient.BaseURL,
+		WebBaseURL: sr.DefaultClient.WebBaseURL,
+		Client:     sr.DefaultClient.Client,
+		OnSchemaWarning: func(warning sr.SchemaWarning) {
+			counts[warning]++
+		},
+	}
+
+	report := doctorReport{
+		Findings: make([]doctorFinding, 0),
+		Errors:   make([]string, 0),
+	}
+
+	for _, programID := range programIDs {
+		for _, err := range probeProgram(ctx, client, programID) {
+			report.Errors = append(report.Errors, fmt.Sprintf("program %d: %s", programID, err))
+		}
+	}
+
+	for warning, count := range counts {
+		report.Findings = append(report.Findings, doctorFinding{SchemaWarning: warning, Count: count})
+	}
+
+	slices.SortFunc(report.Findings, func(a doctorFinding, b doctorFinding) int {
+		if c := strings.Compare(a.Endpoint, b.Endpoint); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return report
+}
+
+// Err returns an error if fields used by srdl are missing from the responses,
+// or if any request failed. Unknown fields are only reported, as the APIs
+// return fields that srdl doesn't use, such as "listenpodfile". Fields of
+// unexpected types fail to decode and are reported as errors.
+func (r doctorReport) Err() error {
+	missing := 0
+	for _, finding := range r.Findings {
+		if finding.Kind == sr.SchemaWarningMissingField {
+			missing++
+		}
+	}
+
+	if missing > 0 || len(r.Errors) > 0 {
+		return fmt.Errorf("found %d missing fields and %d errors", missing, len(r.Errors))
+	}
+
+	return nil
+}
+
+// probeProgram probes all endpoints used by srdl using the program.
+func probeProgram(ctx context.Context, client *sr.Client, programID int) []error {
+	errs := make([]error, 0)
+
+	if _, err := client.GetProgram(ctx, programID); err != nil {
+		errs = append(errs, fmt.Errorf("failed to get program: %w", err))
+	}
+
+	page, err := client.ListEpisodesInProgram(ctx, programID, &sr.ListEpisodesInProgramOptions{PageSize: 5})
+	if err != nil {
+		return append(errs, fmt.Errorf("failed to list episodes: %w", err))
+	}
+
+	if len(page.Episodes) == 0 {
+		return append(errs, fmt.Errorf("program has no episodes"))
+	}
+
+	episodeID := page.Episodes[0].ID
+
+	if _, err := client.GetEpisode(ctx, episodeID); err != nil {
+		errs = append(errs, fmt.Errorf("failed to get episode %d: %w", episodeID, err))
+	}
+
+	if _, err := client.GetEpisodePlaylist(ctx, episodeID); err != nil && !errors.Is(err, sr.ErrNotFound) {
+		errs = append(errs, fmt.Errorf("failed to get playlist of episode %d: %w", episodeID, err))
+	}
+
+	return errs
+}
+
+func printDoctorReport(report doctorReport, programIDs []int) {
+	fmt.Printf("Probed programs: %v\n", programIDs)
+
+	if len(report.Findings) == 0 && len(report.Errors) == 0 {
+		fmt.Println("No differences found between the SR APIs and the models")
+		return
+	}
+
+	if len(report.Findings) > 0 {
+		fmt.Println()
+		fmt.Println("Schema differences:")
+		endpoint := ""
+		for _, finding := range report.Findings {
+			if finding.Endpoint != endpoint {
+				endpoint = finding.Endpoint
+				fmt.Printf("  %s\n", endpoint)
+			}
+
+			fmt.Printf("    %-7s %s (seen %d times)\n", finding.Kind, finding.Path, finding.Count)
+		}
+	}
+
+	if len(report.Errors) > 0 {
+		fmt.Println()
+		fmt.Println("Errors:")
+		for _, err := range report.Errors {
+			fmt.Printf("  %s\n", err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/AlexGustafsson/srdl/internal/sr/srtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbePrograms(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	// Healthy APIs don't fail the command
+	report := probePrograms(context.TODO(), []int{4914, 5082})
+	assert.Empty(t, report.Findings)
+	assert.Empty(t, report.Errors)
+	assert.NoError(t, report.Err())
+
+	// Failing requests do
+	report = probePrograms(context.TODO(), []int{1})
+	require.NotEmpty(t, report.Errors)
+	assert.Contains(t, report.Errors[0], "program 1: failed to get program")
+	assert.Error(t, report.Err())
+}
+
+func TestDoctorReportErr(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Report doctorReport
+		Fails  bool
+	}{
+		{
+			Name:   "no findings",
+			Report: doctorReport{},
+			Fails:  false,
+		},
+		{
+			Name: "unknown field",
+			Report: doctorReport{
+				Findings: []doctorFinding{
+					{SchemaWarning: sr.SchemaWarning{Kind: sr.SchemaWarningUnknownField, Endpoint: "/v2/episodes/get", Path: "episode.listenpodfile"}, Count: 3},
+				},
+			},
+			Fails: false,
+		},
+		{
+			Name: "missing field",
+			Report: doctorReport{
+				Findings: []doctorFinding{
+					{SchemaWarning: sr.SchemaWarning{Kind: sr.SchemaWarningMissingField, Endpoint: "/v2/episodes/get", Path: "episode.title"}, Count: 1},
+				},
+			},
+			Fails: true,
+		},
+		{
+			Name:   "error",
+			Report: doctorReport{Errors: []string{"program 4914: failed to get program"}},
+			Fails:  true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			err := testCase.Report.Err()
+			if testCase.Fails {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
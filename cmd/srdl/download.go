@@ -10,10 +10,12 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/AlexGustafsson/srdl/internal/fsutil"
 	"github.com/AlexGustafsson/srdl/internal/httputil"
-	"github.com/AlexGustafsson/srdl/internal/mp4"
 	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/AlexGustafsson/srdl/internal/tagging"
 )
 
 func download(args []string) error {
@@ -21,6 +23,8 @@ func download(args []string) error {
 
 	episodeID := commandLine.Int("episode-id", 0, "Episode ID")
 	output := commandLine.String("output", "", "Optional output file path")
+	cacheDir := commandLine.String("cache-dir", "", "Optional directory to cache responses in")
+	cacheTTL := commandLine.Duration("cache-ttl", time.Hour, "Time to consider cached metadata fresh, unless SR specifies otherwise")
 	commandLine.Usage = printUsage
 	commandLine.Parse(args)
 
@@ -29,6 +33,10 @@ func download(args []string) error {
 		os.Exit(1)
 	}
 
+	if *cacheDir != "" {
+		httputil.UseCache(*cacheDir, *cacheTTL)
+	}
+
 	episode, err := sr.DefaultClient.GetEpisode(context.Background(), *episodeID)
 	if err != nil {
 		return fmt.Errorf("failed to get episode: %w", err)
@@ -38,67 +46,65 @@ func download(args []string) error {
 		return fmt.Errorf("no broadcast or pod available for the episode")
 	}
 
-	var url string
-	if episode.Broadcast != nil {
-		// TODO: Check with melodikrysset if there's multiple episodes
-		if len(episode.Broadcast.Files) > 0 {
-			url = episode.Broadcast.Files[0].URL
-		}
-	} else if episode.PodFile != nil {
-		url = episode.PodFile.URL
-	}
-
+	url := episodeFileURL(episode)
 	if url == "" {
 		return fmt.Errorf("no available file found for the episode")
 	}
 
-	if *output == "" {
-		*output = episode.Title + path.Ext(url)
-	}
-
 	program, err := sr.DefaultClient.GetProgram(context.Background(), episode.Program.ID)
 	if err != nil {
 		return fmt.Errorf("failed to get program: %w", err)
 	}
 
-	episodeFile, err := httputil.Download(context.Background(), url)
+	res, err := httputil.Get(context.Background(), url)
 	if err != nil {
 		return fmt.Errorf("failed to download file: %w", err)
 	}
-	defer episodeFile.Close()
+	defer res.Body.Close()
+
+	// NOTE: Sometimes the API seems to return html5desktop, which is redirected
+	// to m4a
+	extension := path.Ext(url)
+	if extension == ".html5desktop" {
+		extension = ".m4a"
+	} else if extension == "" {
+		extension = httputil.ExtensionByContentType(res.Header.Get("Content-Type"))
+	}
 
-	file, err := os.OpenFile(*output, os.O_CREATE|os.O_RDWR, 0644)
+	if *output == "" {
+		*output = episode.Title + extension
+	}
+
+	// Write to a temporary file that replaces the output file once complete, to
+	// never leave partially downloaded episodes
+	file, err := fsutil.CreateAtomic(*output, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
 	defer file.Close()
 
-	if _, err := io.Copy(file, episodeFile); err != nil {
+	if _, err := io.Copy(file, res.Body); err != nil {
 		return fmt.Errorf("failed to download file: %w", err)
 	}
 
-	// Populate MP4 files with metadata. SR already includes metadata in  MP3
-	// files
-	if strings.HasSuffix(url, ".mp4") {
+	// Populate MP4 (m4a) files with metadata. SR already includes metadata in
+	// MP3 files
+	if extension == ".m4a" {
+		meta := tagging.Metadata(episode, program, url)
+
 		if _, err := file.Seek(0, io.SeekStart); err != nil {
 			slog.Warn("Failed to process metadata", slog.Any("error", err))
 			// Ignore the error as it's not critical
-			return nil
-		}
-
-		meta := mp4.Metadata{
-			Title:       episode.Title,
-			Album:       episode.Program.Name,
-			Description: episode.Description,
-			Released:    episode.PublishDate.Time,
-		}
-
-		if err := meta.Write(file); err != nil {
+		} else if err := meta.Write(file.File); err != nil {
 			slog.Warn("Failed to write metadata", slog.Any("error", err))
 			// Ignore the error as it's not critical
 		}
 	}
 
+	if err := file.Commit(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
 	err = httputil.DownloadIfNotExist(context.Background(), filepath.Join(filepath.Dir(*output), "cover"), program.ImageURL)
 	if err != nil {
 		slog.Warn("Failed to download cover image", slog.Any("error", err))
@@ -111,12 +117,6 @@ func download(args []string) error {
 		// Ignore the error as it's not critical
 	}
 
-	err = httputil.DownloadIfNotExist(context.Background(), filepath.Join(filepath.Dir(*output), "backdrop"), program.ImageTemplateWideURL)
-	if err != nil {
-		slog.Warn("Failed to download episode image", slog.Any("error", err))
-		// Ignore the error as it's not critical
-	}
-
 	episodeImagePath := filepath.Join(filepath.Dir(*output), strings.TrimSuffix(filepath.Base(*output), filepath.Ext(*output)))
 	if err := httputil.DownloadIfNotExist(context.Background(), episodeImagePath, episode.ImageURL); err != nil {
 		slog.Warn("Failed to download episode image", slog.Any("error", err))
@@ -125,3 +125,18 @@ func download(args []string) error {
 
 	return nil
 }
+
+// episodeFileURL returns the URL of the audio file of an episode, preferring
+// broadcasts over pods. Returns an empty string if there is no file.
+func episodeFileURL(episode *sr.Episode) string {
+	if episode.Broadcast != nil {
+		// TODO: Check with melodikrysset if there's multiple episodes
+		if len(episode.Broadcast.Files) > 0 {
+			return episode.Broadcast.Files[0].URL
+		}
+	} else if episode.PodFile != nil {
+		return episode.PodFile.URL
+	}
+
+	return ""
+}
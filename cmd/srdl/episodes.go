@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -33,7 +34,7 @@ func episodes(args []string) error {
 		PageSize: *pageSize,
 	}
 	episodes, err := sr.DefaultClient.ListEpisodesInProgram(ctx, *programID, listOptions)
-	if err == sr.ErrNotFound {
+	if errors.Is(err, sr.ErrNotFound) {
 		fmt.Fprintf(os.Stderr, "Program not found")
 		return err
 	} else if err != nil {
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/mp4"
+)
+
+func inspect(args []string) error {
+	commandLine := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+	format := commandLine.String("format", "text", "Output format, either text or json")
+	commandLine.Usage = printUsage
+	commandLine.Parse(args)
+
+	path := commandLine.Arg(0)
+	if path == "" || (*format != "text" && *format != "json") {
+		commandLine.Usage()
+		os.Exit(1)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	inspection, err := mp4.Inspect(file, stat.Size())
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(inspection)
+	}
+
+	return writeInspectionText(os.Stdout, inspection)
+}
+
+// writeInspectionText writes a human-readable form of inspection to w.
+func writeInspectionText(w io.Writer, inspection *mp4.Inspection) error {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "Duration: %s\n", inspection.Duration)
+	fmt.Fprintf(&builder, "Bitrate: %d b/s\n", inspection.Bitrate)
+
+	builder.WriteString("\nTracks:\n")
+	if len(inspection.Tracks) == 0 {
+		builder.WriteString("  None\n")
+	}
+	for _, track := range inspection.Tracks {
+		fields := []string{track.Handler, track.Codec}
+		if name := mp4.AudioObjectTypeName(track.ObjectType); name != "" {
+			fields = append(fields, name)
+		} else if track.ObjectType != 0 {
+			fields = append(fields, fmt.Sprintf("object type %d", track.ObjectType))
+		}
+		if track.SampleRate > 0 {
+			fields = append(fields, fmt.Sprintf("%d Hz", track.SampleRate))
+		}
+		if track.Channels > 0 {
+			fields = append(fields, fmt.Sprintf("%d channels", track.Channels))
+		}
+		if track.Bitrate > 0 {
+			fields = append(fields, fmt.Sprintf("%d b/s", track.Bitrate))
+		}
+		fields = append(fields, track.Duration.String())
+		fmt.Fprintf(&builder, "  Track %d: %s\n", track.ID, strings.Join(fields, ", "))
+	}
+
+	builder.WriteString("\nMetadata:\n")
+	writeMetadataText(&builder, inspection.Metadata)
+
+	builder.WriteString("\nBoxes:\n")
+	writeBoxesText(&builder, inspection.Boxes, "  ")
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// writeMetadataText writes the set fields of metadata, named as when encoded
+// as JSON.
+func writeMetadataText(builder *strings.Builder, metadata *mp4.Metadata) {
+	empty := true
+
+	value := reflect.ValueOf(*metadata)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("json"), ",")
+		if field.IsZero() {
+			continue
+		}
+
+		switch v := field.Interface().(type) {
+		case string, bool:
+			fmt.Fprintf(builder, "  %s: %v\n", name, v)
+		case mp4.Pair:
+			fmt.Fprintf(builder, "  %s: %d/%d\n", name, v.Number, v.Total)
+		case time.Time:
+			fmt.Fprintf(builder, "  %s: %s\n", name, v.Format(time.RFC3339))
+		default:
+			continue
+		}
+		empty = false
+	}
+
+	for _, item := range metadata.Freeform {
+		fmt.Fprintf(builder, "  %s:%s: %s\n", item.Mean, item.Name, item.Value)
+		empty = false
+	}
+
+	for _, item := range metadata.Unknown {
+		// Types such as "\xa9too" are Latin-1
+		var name strings.Builder
+		for _, b := range []byte(item.Type) {
+			name.WriteRune(rune(b))
+		}
+		fmt.Fprintf(builder, "  %s: %d bytes\n", name.String(), len(item.Data))
+		empty = false
+	}
+
+	if empty {
+		builder.WriteString("  None\n")
+	}
+}
+
+// writeBoxesText writes the tree of boxes, indenting children.
+func writeBoxesText(builder *strings.Builder, boxes []mp4.BoxInfo, indent string) {
+	for _, box := range boxes {
+		fmt.Fprintf(builder, "%s%s @%d, %d bytes\n", indent, box.Type, box.Offset, box.Size)
+		writeBoxesText(builder, box.Children, indent+"  ")
+	}
+}
@@ -9,13 +9,23 @@ const usageTemplate = `usage: %[1]s <command> [options...] [args...]
 
 commands:
 - program
+- episodes
 - download
+- doctor
+- tags
+- retag
+- inspect
 
 examples:
 
 %[1]s program <url>
 %[1]s episodes -program-id 1234
 %[1]s download -output file -episode-id 1234
+%[1]s download -cache-dir cache -episode-id 1234
+%[1]s doctor -program-id 4914
+%[1]s tags file.m4a
+%[1]s retag -dry-run output
+%[1]s inspect -format json file.m4a
 `
 
 func printUsage() {
@@ -42,6 +52,14 @@ func main() {
 		err = episodes(os.Args[2:])
 	case "download":
 		err = download(os.Args[2:])
+	case "doctor":
+		err = doctor(os.Args[2:])
+	case "tags":
+		err = tags(os.Args[2:])
+	case "retag":
+		err = retag(os.Args[2:])
+	case "inspect":
+		err = inspect(os.Args[2:])
 	default:
 		err = fmt.Errorf("invalid command: %s", command)
 	}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -26,10 +27,10 @@ func program(args []string) error {
 	defer cancel()
 
 	programID, err := sr.DefaultClient.GetProgramID(ctx, url)
-	if err == sr.ErrNotFound {
+	if errors.Is(err, sr.ErrNotFound) {
 		fmt.Fprintf(os.Stderr, "Program page not found")
 		return err
-	} else if err == sr.ErrProgramIDNotFound {
+	} else if errors.Is(err, sr.ErrProgramIDNotFound) {
 		fmt.Fprintf(os.Stderr, "Cannot identify program id")
 		return err
 	} else if err != nil {
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/fsutil"
+	"github.com/AlexGustafsson/srdl/internal/httputil"
+	"github.com/AlexGustafsson/srdl/internal/mp4"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/AlexGustafsson/srdl/internal/state"
+	"github.com/AlexGustafsson/srdl/internal/tagging"
+)
+
+// Statuses of retagged files.
+const (
+	retagStatusUpdated   = "updated"
+	retagStatusUnchanged = "unchanged"
+	retagStatusUnmatched = "unmatched"
+	retagStatusFailed    = "failed"
+)
+
+// Ways files are matched with episodes.
+const (
+	retagMatchIdentifiers = "identifiers"
+	retagMatchState       = "state"
+	retagMatchEpisodeID   = "episodeId"
+	retagMatchTitle       = "title"
+)
+
+// retagResult is the result of retagging a file.
+type retagResult struct {
+	Path      string `json:"path"`
+	EpisodeID int    `json:"episodeId,omitempty"`
+	// MatchedBy is how the file was matched with its episode.
+	MatchedBy string `json:"matchedBy,omitempty"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+func retag(args []string) error {
+	commandLine := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+	programID := commandLine.Int("program-id", 0, "Optional program ID used to match files without identifiers by title")
+	statePath := commandLine.String("state", "", "Optional path to srdl-sub's state file, used to match files without identifiers by where they were downloaded to")
+	dryRun := commandLine.Bool("dry-run", false, "Report the changes without modifying any files")
+	parallelism := commandLine.Int("parallelism", 4, "Number of files to retag concurrently")
+	cacheDir := commandLine.String("cache-dir", "", "Optional directory to cache responses in")
+	cacheTTL := commandLine.Duration("cache-ttl", time.Hour, "Time to consider cached metadata fresh, unless SR specifies otherwise")
+	commandLine.Usage = printUsage
+	commandLine.Parse(args)
+
+	root := commandLine.Arg(0)
+	if root == "" || *parallelism <= 0 {
+		commandLine.Usage()
+		os.Exit(1)
+	}
+
+	if *cacheDir != "" {
+		httputil.UseCache(*cacheDir, *cacheTTL)
+	}
+
+	paths := make([]string, 0)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden files, such as partially downloaded episodes
+		if path != root && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// SR already includes metadata in MP3 files, so only MP4 (m4a) files are
+		// tagged
+		if entry.Type().IsRegular() && filepath.Ext(path) == ".m4a" {
+			paths = append(paths, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var store *state.Store
+	if *statePath != "" {
+		var err error
+		store, err = state.Open(*statePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	retagger := &retagger{
+		ProgramID: *programID,
+		State:     store,
+		DryRun:    *dryRun,
+		Started:   time.Now(),
+	}
+
+	results := make([]retagResult, len(paths))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for range *parallelism {
+		wg.Go(func() {
+			for i := range indexes {
+				results[i] = retagger.Retag(context.Background(), paths[i])
+			}
+		})
+	}
+
+	for i := range paths {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Status == retagStatusFailed {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to retag %d files", failed)
+	}
+
+	return nil
+}
+
+// retagger rewrites the metadata and images of downloaded episodes. It's safe
+// for concurrent use. Chapters are not written, as downloaded episodes don't
+// have any.
+type retagger struct {
+	// ProgramID is the program whose episodes are matched by title with files
+	// that don't identify their program.
+	ProgramID int
+	// State optionally identifies files without identifiers by the paths
+	// their episodes were recorded with when downloaded. It's never modified.
+	State *state.Store
+	// DryRun disables all modifications of files.
+	DryRun bool
+	// Started is when retagging started. Images that have been checked since
+	// are not refreshed again.
+	Started time.Time
+
+	mu       sync.Mutex
+	programs map[int]func() (*sr.Program, error)
+	episodes map[int]func() ([]sr.Episode, error)
+}
+
+// Retag rewrites the metadata and images of the episode at path.
+func (r *retagger) Retag(ctx context.Context, path string) retagResult {
+	result := retagResult{Path: path}
+
+	mode := os.O_RDWR
+	if r.DryRun {
+		mode = os.O_RDONLY
+	}
+
+	file, err := os.OpenFile(path, mode, 0)
+	if err != nil {
+		return result.fail(err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return result.fail(err)
+	}
+
+	metadata, err := mp4.ReadMetadata(file, stat.Size())
+	if err != nil {
+		return result.fail(fmt.Errorf("failed to read metadata: %w", err))
+	}
+
+	episode, matchedBy, err := r.identify(ctx, path, metadata)
+	if err != nil {
+		return result.fail(err)
+	} else if episode == nil {
+		result.Status = retagStatusUnmatched
+		return result
+	}
+
+	result.EpisodeID = episode.ID
+	result.MatchedBy = matchedBy
+
+	program, err := r.program(ctx, episode.Program.ID)
+	if err != nil {
+		return result.fail(fmt.Errorf("failed to get program: %w", err))
+	}
+
+	sourceURL := tagging.ReadIdentifiers(metadata).SourceURL
+	if sourceURL == "" {
+		sourceURL = episodeFileURL(episode)
+	}
+
+	updated := tagging.Metadata(episode, program, sourceURL)
+
+	// Keep items that are not managed by srdl, such as those written by other
+	// tools
+	for _, item := range metadata.Freeform {
+		if item.Mean != tagging.FreeformMean {
+			updated.Freeform = append(updated.Freeform, item)
+		}
+	}
+	updated.Unknown = metadata.Unknown
+
+	current, err := metadata.Bytes()
+	if err != nil {
+		return result.fail(fmt.Errorf("failed to encode metadata: %w", err))
+	}
+
+	content, err := updated.Bytes()
+	if err != nil {
+		return result.fail(fmt.Errorf("failed to encode metadata: %w", err))
+	}
+
+	result.Status = retagStatusUnchanged
+	if !bytes.Equal(current, content) {
+		result.Status = retagStatusUpdated
+	}
+
+	if r.DryRun {
+		return result
+	}
+
+	if result.Status == retagStatusUpdated {
+		if err := writeMetadata(file, stat, updated); err != nil {
+			return result.fail(fmt.Errorf("failed to write metadata: %w", err))
+		}
+	}
+
+	r.refreshImages(ctx, path, episode, program)
+
+	return result
+}
+
+// writeMetadata writes metadata to the archived file. Metadata that fits in
+// the file's free space is written in place. Otherwise the file is rewritten
+// to a copy that replaces it once complete, as an interrupted rewrite would
+// corrupt the file.
+func writeMetadata(file *os.File, stat os.FileInfo, metadata mp4.Metadata) error {
+	err := metadata.WriteWithOptions(file, &mp4.WriteOptions{Padding: mp4.DefaultPadding, InPlace: true})
+	if !errors.Is(err, mp4.ErrInsufficientSpace) {
+		return err
+	}
+
+	rewritten, err := fsutil.CreateAtomic(file.Name(), stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer rewritten.Close()
+
+	if _, err := io.Copy(rewritten, io.NewSectionReader(file, 0, stat.Size())); err != nil {
+		return err
+	}
+
+	if err := metadata.Write(rewritten.File); err != nil {
+		return err
+	}
+
+	return rewritten.Commit()
+}
+
+// identify returns the episode of the file at path. The episode is identified
+// by the SR identifiers stored in the file. Files without identifiers are
+// matched by the path they were recorded with in the state, if any, or with
+// the episodes of their program using their episode id tag or title. Returns
+// nil if the episode could not be identified.
+func (r *retagger) identify(ctx context.Context, path string, metadata *mp4.Metadata) (*sr.Episode, string, error) {
+	identifiers := tagging.ReadIdentifiers(metadata)
+
+	if identifiers.EpisodeID != 0 {
+		episode, err := sr.DefaultClient.GetEpisode(ctx, identifiers.EpisodeID)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get episode: %w", err)
+		}
+
+		return episode, retagMatchIdentifiers, nil
+	}
+
+	// Episodes that have been renamed by SR since they were downloaded no longer
+	// match by title, but are still recorded with their files
+	if r.State != nil {
+		if episodeID, _, ok := r.State.Find(path); ok {
+			episode, err := sr.DefaultClient.GetEpisode(ctx, episodeID)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to get episode: %w", err)
+			}
+
+			return episode, retagMatchState, nil
+		}
+	}
+
+	programID := identifiers.ProgramID
+	if programID == 0 {
+		programID = r.ProgramID
+	}
+
+	if programID == 0 {
+		return nil, "", nil
+	}
+
+	episodes, err := r.listEpisodes(ctx, programID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list episodes: %w", err)
+	}
+
+	// Files tagged before identifiers were introduced still have their episode
+	// id. Other taggers use the tag for their own episode numbers, so the id is
+	// only trusted if it identifies one of the program's episodes
+	if episodeID, err := strconv.Atoi(metadata.EpisodeID); err == nil && episodeID != 0 {
+		for i, episode := range episodes {
+			if episode.ID == episodeID {
+				return &episodes[i], retagMatchEpisodeID, nil
+			}
+		}
+	}
+
+	// Episodes are named by their title when downloaded
+	titles := []string{metadata.Title, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+	for _, title := range titles {
+		if title == "" {
+			continue
+		}
+
+		var match *sr.Episode
+		for i, episode := range episodes {
+			if episode.Title != title {
+				continue
+			}
+
+			// Ambiguous titles can't be used to identify the episode
+			if match != nil {
+				return nil, "", nil
+			}
+			match = &episodes[i]
+		}
+
+		if match != nil {
+			return match, retagMatchTitle, nil
+		}
+	}
+
+	return nil, "", nil
+}
+
+// program returns the program with the specified id. Programs are fetched once.
+func (r *retagger) program(ctx context.Context, id int) (*sr.Program, error) {
+	r.mu.Lock()
+	if r.programs == nil {
+		r.programs = make(map[int]func() (*sr.Program, error))
+	}
+	get, ok := r.programs[id]
+	if !ok {
+		get = sync.OnceValues(func() (*sr.Program, error) {
+			return sr.DefaultClient.GetProgram(ctx, id)
+		})
+		r.programs[id] = get
+	}
+	r.mu.Unlock()
+
+	return get()
+}
+
+// listEpisodes returns all episodes of the program with the specified id.
+// Episodes are listed once.
+func (r *retagger) listEpisodes(ctx context.Context, programID int) ([]sr.Episode, error) {
+	r.mu.Lock()
+	if r.episodes == nil {
+		r.episodes = make(map[int]func() ([]sr.Episode, error))
+	}
+	list, ok := r.episodes[programID]
+	if !ok {
+		list = sync.OnceValues(func() ([]sr.Episode, error) {
+			return sr.DefaultClient.ListAllEpisodesInProgram(ctx, programID)
+		})
+		r.episodes[programID] = list
+	}
+	r.mu.Unlock()
+
+	return list()
+}
+
+// refreshImages replaces the cover, backdrop and episode images next to the
+// episode at path if they have changed, like they're named by download.
+func (r *retagger) refreshImages(ctx context.Context, path string, episode *sr.Episode, program *sr.Program) {
+	dir := filepath.Dir(path)
+
+	// Images shared by episodes in the same directory are only checked once
+	refreshInterval := time.Since(r.Started)
+
+	err := httputil.DownloadOrRefresh(ctx, filepath.Join(dir, "cover"), program.ImageURL, refreshInterval)
+	if err != nil {
+		slog.Warn("Failed to refresh cover image", slog.String("path", path), slog.Any("error", err))
+		// Ignore the error as it's not critical
+	}
+
+	err = httputil.DownloadOrRefresh(ctx, filepath.Join(dir, "backdrop"), program.ImageTemplateWideURL, refreshInterval)
+	if err != nil {
+		slog.Warn("Failed to refresh backdrop image", slog.String("path", path), slog.Any("error", err))
+		// Ignore the error as it's not critical
+	}
+
+	episodeImagePath := filepath.Join(dir, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	if err := httputil.DownloadOrRefresh(ctx, episodeImagePath, episode.ImageURL, refreshInterval); err != nil {
+		slog.Warn("Failed to refresh episode image", slog.String("path", path), slog.Any("error", err))
+		// Ignore the error as it's not critical
+	}
+}
+
+// fail marks the result as failed with err.
+func (r retagResult) fail(err error) retagResult {
+	r.Status = retagStatusFailed
+	r.Error = err.Error()
+	return r
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/httputil"
+	"github.com/AlexGustafsson/srdl/internal/mp4"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/AlexGustafsson/srdl/internal/sr/srtest"
+	"github.com/AlexGustafsson/srdl/internal/state"
+	"github.com/AlexGustafsson/srdl/internal/tagging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetag(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	dir := t.TempDir()
+	path := createArchivedFile(t, dir, "Carpe diem.m4a", tagging.Identifiers{EpisodeID: 2522448})
+
+	retagger := &retagger{Started: time.Now()}
+	result := retagger.Retag(context.TODO(), path)
+	assert.Equal(t, retagResult{
+		Path:      path,
+		EpisodeID: 2522448,
+		MatchedBy: retagMatchIdentifiers,
+		Status:    retagStatusUpdated,
+	}, result)
+
+	// The metadata doesn't fit in the file's free space, so the file is
+	// replaced by a rewritten copy
+	metadata := readArchivedFile(t, path)
+	assert.Equal(t, "Carpe diem", metadata.Title)
+	assert.Equal(t, 2522448, tagging.ReadIdentifiers(metadata).EpisodeID)
+
+	// No temporary files are left behind
+	assert.Equal(t, []string{
+		".Carpe diem.jpg.http.json",
+		".backdrop.jpg.http.json",
+		".cover.jpg.http.json",
+		"Carpe diem.jpg",
+		"Carpe diem.m4a",
+		"backdrop.jpg",
+		"cover.jpg",
+	}, files(t, dir))
+
+	// Retagging again leaves the file unchanged
+	result = retagger.Retag(context.TODO(), path)
+	assert.Equal(t, retagStatusUnchanged, result.Status)
+}
+
+func TestRetagExtensionlessImage(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	// Serve the episode's image at a URL without an extension
+	episode, err := server.Client().GetEpisode(context.TODO(), 2522448)
+	require.NoError(t, err)
+	episode.ImageURL = server.URL + "/images/4914/episode"
+	server.AddEpisode(*episode)
+
+	dir := t.TempDir()
+	path := createArchivedFile(t, dir, "Carpe diem.m4a", tagging.Identifiers{EpisodeID: 2522448})
+
+	retagger := &retagger{Started: time.Now()}
+	result := retagger.Retag(context.TODO(), path)
+	assert.Equal(t, retagStatusUpdated, result.Status)
+
+	// The image is named by its content type, leaving the episode's audio file
+	// sharing its name untouched
+	image, err := os.ReadFile(filepath.Join(dir, "Carpe diem.jpg"))
+	require.NoError(t, err)
+	fixture, err := os.ReadFile("../../internal/sr/srtest/fixtures/image.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, fixture, image)
+
+	metadata := readArchivedFile(t, path)
+	assert.Equal(t, "Carpe diem", metadata.Title)
+	assert.NotContains(t, files(t, dir), ".Carpe diem.m4a.http.json")
+}
+
+func TestRetagEpisodeIDTag(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	testCases := []struct {
+		Name      string
+		ProgramID int
+		EpisodeID string
+		Expected  retagResult
+	}{
+		{
+			Name:      "listed episode",
+			ProgramID: 4914,
+			EpisodeID: "2522448",
+			Expected:  retagResult{EpisodeID: 2522448, MatchedBy: retagMatchEpisodeID, Status: retagStatusUpdated},
+		},
+		{
+			Name:      "episode number of another tagger",
+			ProgramID: 4914,
+			EpisodeID: "12",
+			Expected:  retagResult{Status: retagStatusUnmatched},
+		},
+		{
+			Name:      "episode of another program",
+			ProgramID: 4914,
+			EpisodeID: "2531337",
+			Expected:  retagResult{Status: retagStatusUnmatched},
+		},
+		{
+			Name:      "unknown program",
+			EpisodeID: "2522448",
+			Expected:  retagResult{Status: retagStatusUnmatched},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := createArchivedFile(t, dir, "Avsnitt.m4a", tagging.Identifiers{})
+
+			file, err := os.OpenFile(path, os.O_RDWR, 0)
+			require.NoError(t, err)
+			defer file.Close()
+			require.NoError(t, mp4.Metadata{EpisodeID: testCase.EpisodeID}.Write(file))
+
+			retagger := &retagger{ProgramID: testCase.ProgramID, DryRun: true, Started: time.Now()}
+			expected := testCase.Expected
+			expected.Path = path
+			assert.Equal(t, expected, retagger.Retag(context.TODO(), path))
+		})
+	}
+}
+
+func TestRetagState(t *testing.T) {
+	server := srtest.NewServer()
+	defer server.Close()
+	useClient(t, server.Client())
+
+	// The episode has been renamed since it was downloaded, so its title no
+	// longer matches the file
+	dir := t.TempDir()
+	path := createArchivedFile(t, dir, "Gammal titel.m4a", tagging.Identifiers{})
+
+	store, err := state.Open("")
+	require.NoError(t, err)
+	require.NoError(t, store.Record(2522448, state.Entry{Path: path}))
+
+	withoutState := &retagger{ProgramID: 4914, DryRun: true, Started: time.Now()}
+	assert.Equal(t, retagResult{Path: path, Status: retagStatusUnmatched}, withoutState.Retag(context.TODO(), path))
+
+	withState := &retagger{State: store, DryRun: true, Started: time.Now()}
+	assert.Equal(t, retagResult{
+		Path:      path,
+		EpisodeID: 2522448,
+		MatchedBy: retagMatchState,
+		Status:    retagStatusUpdated,
+	}, withState.Retag(context.TODO(), path))
+}
+
+// useClient makes the sr and httputil packages use client for the duration of
+// the test.
+func useClient(t *testing.T, client *sr.Client) {
+	previous := sr.DefaultClient
+	previousHTTPClient := httputil.DefaultClient
+	sr.DefaultClient = client
+	httputil.DefaultClient = client.Client
+	t.Cleanup(func() {
+		sr.DefaultClient = previous
+		httputil.DefaultClient = previousHTTPClient
+	})
+}
+
+// createArchivedFile creates an m4a file named name in dir, tagged with the
+// identifiers.
+func createArchivedFile(t *testing.T, dir string, name string, identifiers tagging.Identifiers) string {
+	content, err := os.ReadFile("../../internal/mp4/empty.m4a")
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, content, 0644))
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var metadata mp4.Metadata
+	identifiers.Write(&metadata)
+	require.NoError(t, metadata.WriteWithOptions(file, &mp4.WriteOptions{}))
+
+	return path
+}
+
+// readArchivedFile reads the metadata of the m4a file at path.
+func readArchivedFile(t *testing.T, path string) *mp4.Metadata {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	stat, err := file.Stat()
+	require.NoError(t, err)
+
+	metadata, err := mp4.ReadMetadata(file, stat.Size())
+	require.NoError(t, err)
+
+	return metadata
+}
+
+// files returns the sorted names of the files in dir.
+func files(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := make([]string, 0)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
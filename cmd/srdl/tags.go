@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/AlexGustafsson/srdl/internal/mp4"
+)
+
+func tags(args []string) error {
+	commandLine := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	commandLine.Usage = printUsage
+	commandLine.Parse(args)
+
+	path := commandLine.Arg(0)
+	if path == "" {
+		commandLine.Usage()
+		os.Exit(1)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	metadata, err := mp4.ReadMetadata(file, stat.Size())
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(metadata)
+}
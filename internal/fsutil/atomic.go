@@ -0,0 +1,116 @@
+package fsutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// AtomicFile is a temporary file that atomically replaces the file at its
+// target path once committed. Until then, the target is left untouched.
+type AtomicFile struct {
+	*os.File
+	path      string
+	perm      os.FileMode
+	committed bool
+	closed    bool
+}
+
+// CreateAtomic creates a temporary file in the directory of path, which will
+// replace the file at path when committed.
+// It is the caller's responsibility to close the file. Closing a file that is
+// not committed removes it.
+func CreateAtomic(path string, perm os.FileMode) (*AtomicFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &AtomicFile{
+		File: file,
+		path: path,
+		perm: perm,
+	}, nil
+}
+
+// Commit flushes the file to disk and renames it to its target path.
+// The file is closed.
+func (f *AtomicFile) Commit() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+
+	if err := f.File.Chmod(f.perm); err != nil {
+		return err
+	}
+
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+
+	f.closed = true
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+
+	if err := os.Rename(f.File.Name(), f.path); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	f.committed = true
+
+	// Make sure the rename itself is durable
+	syncDir(filepath.Dir(f.path))
+	return nil
+}
+
+// Close closes the file. If the file is not committed, it's removed.
+// Closing a committed file is a no-op.
+func (f *AtomicFile) Close() error {
+	if f.committed {
+		return nil
+	}
+
+	var err error
+	if !f.closed {
+		f.closed = true
+		err = f.File.Close()
+	}
+
+	if removeErr := os.Remove(f.File.Name()); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+		return removeErr
+	}
+
+	return err
+}
+
+// WriteFileAtomic writes the contents of r to the file at path, atomically
+// replacing it. If writing fails, the file at path is left untouched.
+func WriteFileAtomic(path string, r io.Reader, perm os.FileMode) error {
+	file, err := CreateAtomic(path, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, r); err != nil {
+		return err
+	}
+
+	return file.Commit()
+}
+
+// syncDir tries to flush the directory at path to disk.
+// Not all platforms support syncing directories, such as Windows. As the
+// renamed file itself is already flushed, errors are ignored.
+func syncDir(path string) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+
+	dir.Sync()
+}
@@ -0,0 +1,78 @@
+package fsutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "file")
+
+	require.NoError(t, WriteFileAtomic(path, strings.NewReader("first"), 0644))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(content))
+
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), stat.Mode().Perm())
+
+	// A failed write leaves the existing file untouched
+	failing := io.MultiReader(strings.NewReader("partial"), &failingReader{})
+	require.Error(t, WriteFileAtomic(path, failing, 0644))
+
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(content))
+
+	actual, err := tree(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file"}, actual)
+}
+
+func TestAtomicFile(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "file")
+
+	// Uncommitted files are removed when closed
+	file, err := CreateAtomic(path, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString("uncommitted")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	actual, err := tree(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, actual)
+
+	// Committed files replace the target
+	file, err = CreateAtomic(path, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString("committed")
+	require.NoError(t, err)
+	require.NoError(t, file.Commit())
+	require.NoError(t, file.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "committed", string(content))
+
+	actual, err = tree(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file"}, actual)
+}
+
+type failingReader struct{}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("failed")
+}
@@ -4,13 +4,20 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"time"
 )
 
-// RemoveOldFiles removes all files that have not been modified since maxAge.
-func RemoveOldFiles(root string, maxAge time.Time) error {
-	toRemove := make([]string, 0)
+// OldFiles returns the paths of all files under root that have not been
+// modified since maxAge.
+func OldFiles(root string, maxAge time.Time) ([]string, error) {
+	paths := make([]string, 0)
 	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
 		info, err := d.Info()
 		if err != nil {
 			return err
@@ -24,47 +31,80 @@ func RemoveOldFiles(root string, maxAge time.Time) error {
 			return nil
 		}
 
-		toRemove = append(toRemove, p)
+		paths = append(paths, p)
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	return paths, nil
+}
+
+// RemoveOldFiles removes all files that have not been modified since maxAge.
+// Returns the paths of the removed files.
+func RemoveOldFiles(root string, maxAge time.Time) ([]string, error) {
+	toRemove, err := OldFiles(root, maxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]string, 0, len(toRemove))
 	for _, p := range toRemove {
 		if err := os.Remove(p); err != nil {
-			return err
+			return removed, err
 		}
+		removed = append(removed, p)
 	}
 
-	return err
+	return removed, nil
 }
 
-// RemoveEmptyDirectories removes all empty directories under root.
-func RemoveEmptyDirectories(root string) error {
+// EmptyDirectories returns the paths of all directories under root that
+// contain no files, sorted. Files in excluding are treated as already removed.
+func EmptyDirectories(root string, excluding ...string) ([]string, error) {
 	entries := make(map[string]int)
 	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
 		if p == root {
 			return nil
 		}
 
 		if d.IsDir() {
 			entries[p] = 0
-		} else {
+		} else if !slices.Contains(excluding, p) {
 			entries[filepath.Dir(p)]++
 		}
 
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	paths := make([]string, 0)
 	for dir, files := range entries {
-		if files != 0 {
-			continue
+		if files == 0 {
+			paths = append(paths, dir)
 		}
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// RemoveEmptyDirectories removes all empty directories under root.
+func RemoveEmptyDirectories(root string) error {
+	dirs, err := EmptyDirectories(root)
+	if err != nil {
+		return err
+	}
 
+	// Remove nested directories before their parents
+	for _, dir := range slices.Backward(dirs) {
 		if err := os.Remove(dir); err != nil {
 			return err
 		}
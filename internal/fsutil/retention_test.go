@@ -47,7 +47,15 @@ func TestRemoveOldFiles(t *testing.T) {
 		"old2",
 	}, beforeDelete)
 
-	require.NoError(t, RemoveOldFiles(root, time.Now().Add(-1*time.Hour)))
+	removed, err := RemoveOldFiles(root, time.Now().Add(-1*time.Hour))
+	require.NoError(t, err)
+	sort.Strings(removed)
+	assert.Equal(t, []string{
+		filepath.Join(root, "new", "old1"),
+		filepath.Join(root, "new", "old2"),
+		filepath.Join(root, "old", "old1"),
+		filepath.Join(root, "old", "old2"),
+	}, removed)
 
 	afterDelete, err := tree(root)
 	require.NoError(t, err)
@@ -116,6 +124,39 @@ func TestRemoveEmptyDirectories(t *testing.T) {
 	}, afterDelete)
 }
 
+func TestEmptyDirectories(t *testing.T) {
+	root := t.TempDir()
+
+	require.NoError(t, createDir(filepath.Join(root, "a"), time.Now()))
+	require.NoError(t, createFile(filepath.Join(root, "a", "old"), time.Now().Add(-2*time.Hour)))
+	require.NoError(t, createDir(filepath.Join(root, "a", "b"), time.Now()))
+	require.NoError(t, createDir(filepath.Join(root, "c"), time.Now()))
+	require.NoError(t, createFile(filepath.Join(root, "c", "new"), time.Now()))
+
+	dirs, err := EmptyDirectories(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "a", "b")}, dirs)
+
+	// Planning retention doesn't remove files, so directories that would be
+	// empty are found by excluding the old files
+	old, err := OldFiles(root, time.Now().Add(-1*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "a", "old")}, old)
+
+	dirs, err = EmptyDirectories(root, old...)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "a"), filepath.Join(root, "a", "b")}, dirs)
+
+	// Nested empty directories are removed
+	_, err = RemoveOldFiles(root, time.Now().Add(-1*time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, RemoveEmptyDirectories(root))
+
+	actual, err := tree(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "c/new"}, actual)
+}
+
 func tree(root string) ([]string, error) {
 	entries := make([]string, 0)
 	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
@@ -0,0 +1,391 @@
+package httputil
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ http.RoundTripper = (*CacheTransport)(nil)
+
+// DefaultCacheMaxSize is the default maximum size of a response body to cache.
+const DefaultCacheMaxSize = 8 << 20
+
+// cachedAtHeader is the header used to store the time a response was stored
+// or revalidated.
+const cachedAtHeader = "X-Srdl-Cached-At"
+
+// CacheTransport caches responses on disk.
+//
+// It implements the semantics of a private cache as described by RFC 7234.
+// Responses are considered fresh as described by their Cache-Control max-age
+// directive or Expires header. Stale responses with an ETag or Last-Modified
+// header are revalidated using conditional requests.
+//
+// Only successful responses to GET requests are cached. Responses of a media
+// type that was not requested, such as error pages served instead of the
+// requested resource, are never cached. Neither are audio and video, such as
+// episodes.
+type CacheTransport struct {
+	// Dir is the directory to store responses in.
+	Dir string
+	// TTL is the time responses without explicit freshness information are
+	// considered fresh. If zero, such responses are always revalidated.
+	TTL time.Duration
+	// MaxSize is the maximum size of response bodies to cache. Larger responses
+	// are passed through. Defaults to [DefaultCacheMaxSize].
+	MaxSize int64
+	// Transport is the transport used to perform requests.
+	// Defaults to [http.DefaultTransport].
+	Transport http.RoundTripper
+}
+
+func (t *CacheTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	requestCacheControl := parseCacheControl(r.Header.Get("Cache-Control"))
+	if r.Method != http.MethodGet || r.Header.Get("Range") != "" || requestCacheControl.Has("no-store") {
+		return transport.RoundTrip(r)
+	}
+
+	path := t.path(r)
+
+	cached, err := t.load(path, r)
+	if err != nil && !os.IsNotExist(err) {
+		slog.Debug("Ignoring invalid cached response", slog.String("url", r.URL.String()), slog.Any("error", err))
+	}
+
+	if cached != nil {
+		if !requestCacheControl.Has("no-cache") && isFresh(cached.Header, t.TTL, time.Now()) {
+			slog.Debug("Using cached response", slog.String("url", r.URL.String()))
+			return cached, nil
+		}
+
+		etag := cached.Header.Get("ETag")
+		lastModified := cached.Header.Get("Last-Modified")
+		if etag == "" && lastModified == "" {
+			cached.Body.Close()
+			cached = nil
+		} else {
+			r = r.Clone(r.Context())
+			if etag != "" {
+				r.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				r.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+
+	res, err := transport.RoundTrip(r)
+	if err != nil {
+		if cached != nil {
+			cached.Body.Close()
+		}
+		return nil, err
+	}
+
+	if cached != nil {
+		if res.StatusCode == http.StatusNotModified {
+			res.Body.Close()
+
+			slog.Debug("Revalidated cached response", slog.String("url", r.URL.String()))
+
+			// Update the stored headers with the ones from the revalidation
+			for key, values := range res.Header {
+				cached.Header[key] = values
+			}
+			cached.Header.Set(cachedAtHeader, time.Now().UTC().Format(time.RFC3339Nano))
+
+			body, err := io.ReadAll(cached.Body)
+			cached.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := t.store(path, cached, body); err != nil {
+				slog.Warn("Failed to update cached response", slog.String("url", r.URL.String()), slog.Any("error", err))
+			}
+
+			cached.Body = io.NopCloser(bytes.NewReader(body))
+			return cached, nil
+		}
+
+		cached.Body.Close()
+	}
+
+	if !isCacheable(r, res) {
+		return res, nil
+	}
+
+	maxSize := t.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultCacheMaxSize
+	}
+
+	if res.ContentLength > maxSize {
+		return res, nil
+	}
+
+	// Read at most maxSize bytes. If the body is larger, pass the remainder
+	// through without caching
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	if int64(len(body)) > maxSize {
+		res.Body = &readCloser{
+			Reader: io.MultiReader(bytes.NewReader(body), res.Body),
+			Closer: res.Body,
+		}
+		return res, nil
+	}
+	res.Body.Close()
+
+	res.Header.Set(cachedAtHeader, time.Now().UTC().Format(time.RFC3339Nano))
+	if err := t.store(path, res, body); err != nil {
+		slog.Warn("Failed to cache response", slog.String("url", r.URL.String()), slog.Any("error", err))
+	}
+	res.Header.Del(cachedAtHeader)
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
+
+// path returns the path to the cache entry of r.
+func (t *CacheTransport) path(r *http.Request) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method)
+	io.WriteString(hash, "\n")
+	io.WriteString(hash, r.URL.String())
+	io.WriteString(hash, "\n")
+	// Different representations may be requested for the same URL
+	io.WriteString(hash, r.Header.Get("Accept"))
+	return filepath.Join(t.Dir, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// load reads the cached response at path.
+func (t *CacheTransport) load(path string, r *http.Request) (*http.Response, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	res, err := http.ReadResponse(bufio.NewReader(file), r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the body before closing the file
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	return res, nil
+}
+
+// store writes res with body to path.
+func (t *CacheTransport) store(path string, res *http.Response, body []byte) error {
+	if err := os.MkdirAll(t.Dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	stored := &http.Response{
+		Status:        res.Status,
+		StatusCode:    res.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        res.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	// The body is stored decoded and in full
+	stored.Header.Del("Content-Encoding")
+	stored.Header.Del("Transfer-Encoding")
+
+	file, err := os.CreateTemp(t.Dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := stored.Write(file); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// isCacheable returns whether or not res to r may be stored.
+func isCacheable(r *http.Request, res *http.Response) bool {
+	if res.StatusCode != http.StatusOK {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/") {
+		return false
+	}
+
+	if !isAccepted(r.Header.Get("Accept"), mediaType) {
+		return false
+	}
+
+	if res.Header.Get("Vary") == "*" {
+		return false
+	}
+
+	return !parseCacheControl(res.Header.Get("Cache-Control")).Has("no-store")
+}
+
+// isAccepted returns whether or not mediaType is accepted by the media
+// ranges of an Accept header. All media types are accepted if the header is
+// empty.
+func isAccepted(accept string, mediaType string) bool {
+	if accept == "" {
+		return true
+	}
+
+	for mediaRange := range strings.SplitSeq(accept, ",") {
+		acceptedType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+
+		if q, ok := params["q"]; ok {
+			if weight, err := strconv.ParseFloat(q, 64); err != nil || weight <= 0 {
+				continue
+			}
+		}
+
+		if acceptedType == "*/*" || acceptedType == mediaType {
+			return true
+		}
+
+		if prefix, ok := strings.CutSuffix(acceptedType, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UseCache makes [DefaultClient] cache responses in dir, using a
+// [CacheTransport] with the specified ttl. Clients sharing DefaultClient, such
+// as sr.DefaultClient, cache responses as well. Using the cache again
+// reconfigures it, rather than wrapping the transport again.
+func UseCache(dir string, ttl time.Duration) {
+	if cache, ok := DefaultClient.Transport.(*CacheTransport); ok {
+		cache.Dir = dir
+		cache.TTL = ttl
+		return
+	}
+
+	DefaultClient.Transport = &CacheTransport{
+		Dir:       dir,
+		TTL:       ttl,
+		Transport: DefaultClient.Transport,
+	}
+}
+
+// isFresh returns whether or not the stored response with header is fresh at
+// now. ttl is used as the freshness lifetime of responses without explicit
+// freshness information.
+func isFresh(header http.Header, ttl time.Duration, now time.Time) bool {
+	cachedAt, err := time.Parse(time.RFC3339Nano, header.Get(cachedAtHeader))
+	if err != nil {
+		return false
+	}
+
+	cacheControl := parseCacheControl(header.Get("Cache-Control"))
+	if cacheControl.Has("no-cache") {
+		return false
+	}
+
+	// The age of the response when it was stored
+	var initialAge time.Duration
+	if age, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil && age > 0 {
+		initialAge = time.Duration(age) * time.Second
+	}
+
+	age := initialAge + now.Sub(cachedAt)
+
+	var lifetime time.Duration
+	if maxAge, ok := cacheControl["max-age"]; ok {
+		seconds, err := strconv.ParseInt(maxAge, 10, 64)
+		if err != nil {
+			return false
+		}
+		lifetime = time.Duration(seconds) * time.Second
+	} else if expires := header.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			return false
+		}
+
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = cachedAt
+		}
+
+		lifetime = expiresAt.Sub(date)
+	} else {
+		lifetime = ttl
+	}
+
+	return age < lifetime
+}
+
+type cacheControl map[string]string
+
+// parseCacheControl parses the value of a Cache-Control header.
+func parseCacheControl(value string) cacheControl {
+	directives := make(cacheControl)
+	for directive := range strings.SplitSeq(value, ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+
+		key, value, _ := strings.Cut(directive, "=")
+		directives[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+
+	return directives
+}
+
+// Has returns whether or not the directive is set.
+func (c cacheControl) Has(directive string) bool {
+	_, ok := c[directive]
+	return ok
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,271 @@
+package httputil
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheTransport(t *testing.T) {
+	requests := make(map[string]int)
+	revalidations := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+
+		switch r.URL.Path {
+		case "/max-age":
+			w.Header().Set("Cache-Control", "max-age=3600")
+		case "/expired":
+			w.Header().Set("Cache-Control", "max-age=0")
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				revalidations[r.URL.Path]++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/last-modified":
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			if r.Header.Get("If-Modified-Since") != "" {
+				revalidations[r.URL.Path]++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/heuristic":
+			// No explicit freshness
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/large":
+			w.Header().Set("Cache-Control", "max-age=3600")
+			w.Write([]byte(strings.Repeat("a", 1024)))
+			return
+		case "/html":
+			w.Header().Set("Cache-Control", "max-age=3600")
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		case "/audio":
+			w.Header().Set("Cache-Control", "max-age=3600")
+			w.Header().Set("Content-Type", "audio/mp4")
+		case "/not-found":
+			w.Header().Set("Cache-Control", "max-age=3600")
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte("Hello, World!"))
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		Path                  string
+		Accept                string
+		TTL                   time.Duration
+		ExpectedRequests      int
+		ExpectedRevalidations int
+		ExpectedBody          string
+	}{
+		{
+			Path:             "/max-age",
+			ExpectedRequests: 1,
+			ExpectedBody:     "Hello, World!",
+		},
+		{
+			Path:             "/expired",
+			ExpectedRequests: 3,
+			ExpectedBody:     "Hello, World!",
+		},
+		{
+			Path:                  "/etag",
+			ExpectedRequests:      3,
+			ExpectedRevalidations: 2,
+			ExpectedBody:          "Hello, World!",
+		},
+		{
+			Path:                  "/last-modified",
+			ExpectedRequests:      3,
+			ExpectedRevalidations: 2,
+			ExpectedBody:          "Hello, World!",
+		},
+		{
+			Path:             "/heuristic",
+			TTL:              time.Hour,
+			ExpectedRequests: 1,
+			ExpectedBody:     "Hello, World!",
+		},
+		{
+			Path:             "/heuristic",
+			ExpectedRequests: 3,
+			ExpectedBody:     "Hello, World!",
+		},
+		{
+			Path:             "/no-store",
+			ExpectedRequests: 3,
+			ExpectedBody:     "Hello, World!",
+		},
+		{
+			Path:             "/large",
+			ExpectedRequests: 3,
+			ExpectedBody:     strings.Repeat("a", 1024),
+		},
+		{
+			Path:             "/html",
+			Accept:           "application/json",
+			ExpectedRequests: 3,
+			ExpectedBody:     "Hello, World!",
+		},
+		{
+			Path:             "/html",
+			Accept:           "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			ExpectedRequests: 1,
+			ExpectedBody:     "Hello, World!",
+		},
+		{
+			Path:             "/html",
+			Accept:           "text/*",
+			ExpectedRequests: 1,
+			ExpectedBody:     "Hello, World!",
+		},
+		{
+			Path:             "/html",
+			Accept:           "application/json, text/html;q=0",
+			ExpectedRequests: 3,
+			ExpectedBody:     "Hello, World!",
+		},
+		{
+			Path:             "/audio",
+			ExpectedRequests: 3,
+			ExpectedBody:     "Hello, World!",
+		},
+		{
+			Path:             "/not-found",
+			ExpectedRequests: 3,
+			ExpectedBody:     "404 page not found\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Path+" "+testCase.Accept, func(t *testing.T) {
+			clear(requests)
+			clear(revalidations)
+
+			client := &http.Client{
+				Transport: &CacheTransport{
+					Dir:       t.TempDir(),
+					TTL:       testCase.TTL,
+					MaxSize:   512,
+					Transport: server.Client().Transport,
+				},
+			}
+
+			for i := 0; i < 3; i++ {
+				req, err := http.NewRequest(http.MethodGet, server.URL+testCase.Path, nil)
+				require.NoError(t, err)
+				if testCase.Accept != "" {
+					req.Header.Set("Accept", testCase.Accept)
+				}
+
+				res, err := client.Do(req)
+				require.NoError(t, err)
+
+				body, err := io.ReadAll(res.Body)
+				res.Body.Close()
+				require.NoError(t, err)
+				assert.Equal(t, testCase.ExpectedBody, string(body))
+			}
+
+			assert.Equal(t, testCase.ExpectedRequests, requests[testCase.Path])
+			assert.Equal(t, testCase.ExpectedRevalidations, revalidations[testCase.Path])
+		})
+	}
+}
+
+func TestUseCache(t *testing.T) {
+	previous := DefaultClient
+	transport := &http.Transport{}
+	DefaultClient = &http.Client{Transport: transport}
+	t.Cleanup(func() {
+		DefaultClient = previous
+	})
+
+	UseCache("a", time.Minute)
+	UseCache("b", time.Hour)
+
+	// Using the cache again reconfigures it rather than wrapping it again
+	assert.Equal(t, &CacheTransport{Dir: "b", TTL: time.Hour, Transport: transport}, DefaultClient.Transport)
+}
+
+func TestIsFresh(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cachedAt := now.Add(-10 * time.Minute).Format(time.RFC3339Nano)
+
+	testCases := []struct {
+		Name     string
+		Header   http.Header
+		TTL      time.Duration
+		Expected bool
+	}{
+		{
+			Name:     "Max age",
+			Header:   http.Header{"Cache-Control": {"public, max-age=3600"}},
+			Expected: true,
+		},
+		{
+			Name:     "Max age with age",
+			Header:   http.Header{"Cache-Control": {"max-age=3600"}, "Age": {"3300"}},
+			Expected: false,
+		},
+		{
+			Name: "Expires",
+			Header: http.Header{
+				"Date":    {"Wed, 01 Jan 2025 11:50:00 GMT"},
+				"Expires": {"Wed, 01 Jan 2025 12:30:00 GMT"},
+			},
+			Expected: true,
+		},
+		{
+			Name: "Expired",
+			Header: http.Header{
+				"Date":    {"Wed, 01 Jan 2025 11:50:00 GMT"},
+				"Expires": {"Wed, 01 Jan 2025 11:55:00 GMT"},
+			},
+			Expected: false,
+		},
+		{
+			Name:     "Invalid expires",
+			Header:   http.Header{"Expires": {"0"}},
+			TTL:      time.Hour,
+			Expected: false,
+		},
+		{
+			Name:     "Max age takes precedence over TTL",
+			Header:   http.Header{"Cache-Control": {"max-age=60"}},
+			TTL:      time.Hour,
+			Expected: false,
+		},
+		{
+			Name:     "TTL",
+			Header:   http.Header{},
+			TTL:      time.Hour,
+			Expected: true,
+		},
+		{
+			Name:     "No cache",
+			Header:   http.Header{"Cache-Control": {"no-cache"}},
+			TTL:      time.Hour,
+			Expected: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			testCase.Header.Set(cachedAtHeader, cachedAt)
+			assert.Equal(t, testCase.Expected, isFresh(testCase.Header, testCase.TTL, now))
+		})
+	}
+}
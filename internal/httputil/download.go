@@ -4,17 +4,43 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/AlexGustafsson/srdl/internal/fsutil"
 
 	urlpkg "net/url"
 	pathpkg "path"
 )
 
-// Download returns a reader for the file at url.
-// It is the caller's responsibility to close the returned reader.
-func Download(ctx context.Context, url string) (io.ReadCloser, error) {
+// preferredExtensions maps media types to their preferred extension, for
+// media types where [mime.ExtensionsByType] is ambiguous.
+var preferredExtensions = map[string]string{
+	"image/jpeg":  ".jpg",
+	"image/png":   ".png",
+	"image/webp":  ".webp",
+	"audio/mp4":   ".m4a",
+	"audio/x-m4a": ".m4a",
+	"audio/mpeg":  ".mp3",
+}
+
+// imageExtensions are the extensions of existing files considered by
+// [resolveExtension]. Other files, such as an episode's audio file sharing
+// the image's name, are never matched.
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".webp": true,
+}
+
+// Get performs a GET request to url, returning the response if it has the
+// status code 200.
+// It is the caller's responsibility to close the response's body.
+func Get(ctx context.Context, url string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
@@ -26,47 +52,125 @@ func Download(ctx context.Context, url string) (io.ReadCloser, error) {
 	}
 
 	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
 		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
 	}
 
+	return res, nil
+}
+
+// Download returns a reader for the file at url.
+// It is the caller's responsibility to close the returned reader.
+func Download(ctx context.Context, url string) (io.ReadCloser, error) {
+	res, err := Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
 	return res.Body, nil
 }
 
+// ExtensionByContentType returns the preferred extension of the media type
+// described by contentType, such as ".jpg" for "image/jpeg". Returns an empty
+// string if the media type is invalid or unknown.
+func ExtensionByContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	if extension, ok := preferredExtensions[mediaType]; ok {
+		return extension
+	}
+
+	extensions, err := mime.ExtensionsByType(mediaType)
+	if err != nil || len(extensions) == 0 {
+		return ""
+	}
+
+	return extensions[0]
+}
+
 // DownloadIfNotExist writes the resource at url to the file at path if it does
 // not already exist. If no extension is specified in path, the extension will
-// be modified to mirror that of the resource at url.
+// be modified to mirror that of the resource at url. If url has no extension
+// either, the extension is based on the resource's content type.
+//
+// The file is written atomically, meaning it's never left partially written.
 func DownloadIfNotExist(ctx context.Context, path string, url string) error {
-	if filepath.Ext(path) == "" {
-		u, err := urlpkg.Parse(url)
-		if err != nil {
+	path, hasExtension, err := resolveExtension(path, url)
+	if err != nil {
+		return err
+	}
+
+	if hasExtension {
+		exists, err := fileExists(path)
+		if err != nil || exists {
 			return err
 		}
-
-		path += pathpkg.Ext(u.Path)
 	}
 
-	stat, err := os.Stat(path)
-	if err == nil && stat.Size() > 0 {
-		return nil
-	} else if err != nil && !os.IsNotExist(err) {
+	res, err := Get(ctx, url)
+	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
+	if !hasExtension {
+		path += ExtensionByContentType(res.Header.Get("Content-Type"))
+
+		exists, err := fileExists(path)
+		if err != nil || exists {
+			return err
+		}
 	}
-	defer file.Close()
 
-	content, err := Download(ctx, url)
+	return fsutil.WriteFileAtomic(path, res.Body, 0644)
+}
+
+// resolveExtension returns path with an extension. If path has no extension,
+// the extension of the resource at url is used. If url has no extension
+// either, the extension of an existing image at path is used. Returns whether
+// or not an extension was resolved.
+func resolveExtension(path string, url string) (string, bool, error) {
+	if filepath.Ext(path) != "" {
+		return path, true, nil
+	}
+
+	u, err := urlpkg.Parse(url)
 	if err != nil {
-		return err
+		return "", false, err
 	}
-	defer content.Close()
 
-	if _, err := io.Copy(file, content); err != nil {
-		return err
+	if extension := pathpkg.Ext(u.Path); extension != "" {
+		return path + extension, true, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil && !os.IsNotExist(err) {
+		return "", false, err
+	}
+
+	prefix := filepath.Base(path) + "."
+	for _, entry := range entries {
+		name := entry.Name()
+		extension := filepath.Ext(name)
+		if entry.Type().IsRegular() && strings.HasPrefix(name, prefix) && extension == name[len(prefix)-1:] && imageExtensions[strings.ToLower(extension)] {
+			return filepath.Join(filepath.Dir(path), name), true, nil
+		}
+	}
+
+	return path, false, nil
+}
+
+// fileExists returns whether or not a non-empty file exists at path.
+func fileExists(path string) (bool, error) {
+	stat, err := os.Stat(path)
+	if err == nil {
+		return stat.Size() > 0, nil
+	} else if os.IsNotExist(err) {
+		return false, nil
 	}
 
-	return nil
+	return false, err
 }
@@ -0,0 +1,76 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadIfNotExist(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("image"))
+		case "/truncated":
+			// Promise more content than is written, failing the copy
+			w.Header().Set("Content-Length", "1024")
+			w.Write([]byte("partial"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	// The extension is resolved from the content type
+	require.NoError(t, DownloadIfNotExist(context.TODO(), filepath.Join(dir, "cover"), server.URL+"/image"))
+	content, err := os.ReadFile(filepath.Join(dir, "cover.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(content))
+	assert.Equal(t, 1, requests)
+
+	// The existing file is found without knowing the content type
+	require.NoError(t, DownloadIfNotExist(context.TODO(), filepath.Join(dir, "cover"), server.URL+"/image"))
+	assert.Equal(t, 1, requests)
+
+	// Failed downloads leave no files behind
+	assert.Error(t, DownloadIfNotExist(context.TODO(), filepath.Join(dir, "backdrop.jpg"), server.URL+"/truncated"))
+	assert.Error(t, DownloadIfNotExist(context.TODO(), filepath.Join(dir, "backdrop.jpg"), server.URL+"/not-found"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "cover.jpg", entries[0].Name())
+}
+
+func TestDownloadIfNotExistAudioSibling(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Episode.m4a"), []byte("audio"), 0644))
+
+	// The episode's audio file shares the name of its image, but is not an image
+	require.NoError(t, DownloadIfNotExist(context.TODO(), filepath.Join(dir, "Episode"), server.URL+"/image"))
+
+	content, err := os.ReadFile(filepath.Join(dir, "Episode.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(content))
+
+	content, err = os.ReadFile(filepath.Join(dir, "Episode.m4a"))
+	require.NoError(t, err)
+	assert.Equal(t, "audio", string(content))
+}
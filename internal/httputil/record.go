@@ -0,0 +1,251 @@
+package httputil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+var _ http.RoundTripper = (*RecorderTransport)(nil)
+
+// VolatileHeaders are headers that are scrubbed from recorded interactions as
+// they change between requests, or contain sensitive values.
+var VolatileHeaders = []string{
+	"Age",
+	"Authorization",
+	"Cookie",
+	"Date",
+	"Expires",
+	"Report-To",
+	"Nel",
+	"Server-Timing",
+	"Set-Cookie",
+	"X-Request-Id",
+	"X-Correlation-Id",
+	"X-Azure-Ref",
+	"X-Cache",
+	"X-Served-By",
+	"X-Timer",
+	"Cf-Ray",
+}
+
+// RecorderMode is the mode of a [RecorderTransport].
+type RecorderMode int
+
+const (
+	// RecorderModeReplay replays previously recorded interactions without
+	// performing any requests.
+	RecorderModeReplay RecorderMode = iota
+	// RecorderModeRecord performs requests and records the interactions.
+	RecorderModeRecord
+)
+
+// Interaction is a recorded request and response pair.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a recorded request.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+}
+
+// RecordedResponse is a recorded response.
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	// Body is the response body. If the body is not valid UTF-8, it's base64
+	// encoded and BodyEncoding is set to "base64".
+	Body         string `json:"body"`
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+}
+
+// RecorderTransport records requests and responses to a file, or replays them
+// from a file, depending on its mode.
+type RecorderTransport struct {
+	// Path is the path to the file containing recorded interactions.
+	Path string
+	// Mode is the mode of the transport.
+	Mode RecorderMode
+	// Transport is the transport used to perform requests while recording.
+	// Defaults to the transport of [DefaultClient].
+	Transport http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+	// replayed holds whether or not an interaction has been replayed, by index.
+	replayed []bool
+}
+
+// NewRecorderTransport returns a new [RecorderTransport]. In replay mode, the
+// recorded interactions are read from path.
+func NewRecorderTransport(path string, mode RecorderMode) (*RecorderTransport, error) {
+	t := &RecorderTransport{
+		Path: path,
+		Mode: mode,
+	}
+
+	if mode == RecorderModeReplay {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(content, &t.interactions); err != nil {
+			return nil, fmt.Errorf("invalid recording: %w", err)
+		}
+
+		t.replayed = make([]bool, len(t.interactions))
+	}
+
+	return t, nil
+}
+
+func (t *RecorderTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.Mode == RecorderModeRecord {
+		return t.record(r)
+	}
+
+	return t.replay(r)
+}
+
+// Save writes all recorded interactions to the transport's path.
+// Does nothing unless the transport is in record mode.
+func (t *RecorderTransport) Save() error {
+	if t.Mode != RecorderModeRecord {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	content, err := json.MarshalIndent(t.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.Path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return os.WriteFile(t.Path, append(content, '\n'), 0644)
+}
+
+func (t *RecorderTransport) record(r *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = DefaultClient.Transport
+	}
+
+	res, err := transport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method: r.Method,
+			URL:    r.URL.String(),
+			Header: scrubHeader(r.Header),
+		},
+		Response: RecordedResponse{
+			StatusCode: res.StatusCode,
+			Header:     scrubHeader(res.Header),
+		},
+	}
+
+	if utf8.Valid(body) {
+		interaction.Response.Body = string(body)
+	} else {
+		interaction.Response.Body = base64.StdEncoding.EncodeToString(body)
+		interaction.Response.BodyEncoding = "base64"
+	}
+
+	t.mu.Lock()
+	t.interactions = append(t.interactions, interaction)
+	t.mu.Unlock()
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
+
+func (t *RecorderTransport) replay(r *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Prefer interactions that have not yet been replayed, making it possible to
+	// replay a sequence of responses to the same request
+	match := -1
+	for i, interaction := range t.interactions {
+		if interaction.Request.Method != r.Method || interaction.Request.URL != r.URL.String() {
+			continue
+		}
+
+		if match == -1 || (t.replayed[match] && !t.replayed[i]) {
+			match = i
+		}
+	}
+
+	if match == -1 {
+		return nil, fmt.Errorf("no recorded interaction for %s %s", r.Method, r.URL.String())
+	}
+
+	t.replayed[match] = true
+	recorded := t.interactions[match].Response
+
+	body := []byte(recorded.Body)
+	if recorded.BodyEncoding == "base64" {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(recorded.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recorded body: %w", err)
+		}
+	}
+
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}, nil
+}
+
+// scrubHeader returns a copy of header without any of the [VolatileHeaders].
+func scrubHeader(header http.Header) http.Header {
+	scrubbed := header.Clone()
+	for _, key := range VolatileHeaders {
+		scrubbed.Del(key)
+	}
+
+	if len(scrubbed) == 0 {
+		return nil
+	}
+
+	return scrubbed
+}
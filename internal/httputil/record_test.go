@@ -0,0 +1,82 @@
+package httputil
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorderTransport(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("X-Request-Id", "abc")
+		switch r.URL.Path {
+		case "/text":
+			w.Write([]byte("Hello, World!"))
+		case "/binary":
+			w.Write([]byte{0xff, 0xfe, 0x00})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "testdata", "recording.json")
+
+	// Record
+	recorder, err := NewRecorderTransport(path, RecorderModeRecord)
+	require.NoError(t, err)
+	recorder.Transport = server.Client().Transport
+
+	client := &http.Client{Transport: recorder}
+	for _, p := range []string{"/text", "/binary", "/missing"} {
+		res, err := client.Get(server.URL + p)
+		require.NoError(t, err)
+		_, err = io.ReadAll(res.Body)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+	require.NoError(t, recorder.Save())
+	assert.Equal(t, 3, requests)
+
+	// Replay
+	replayer, err := NewRecorderTransport(path, RecorderModeReplay)
+	require.NoError(t, err)
+
+	client = &http.Client{Transport: replayer}
+
+	res, err := client.Get(server.URL + "/text")
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "Hello, World!", string(body))
+	assert.Equal(t, "text/plain", res.Header.Get("Content-Type"))
+	assert.Empty(t, res.Header.Get("Set-Cookie"))
+	assert.Empty(t, res.Header.Get("X-Request-Id"))
+	assert.Empty(t, res.Header.Get("Date"))
+
+	res, err = client.Get(server.URL + "/binary")
+	require.NoError(t, err)
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xff, 0xfe, 0x00}, body)
+
+	res, err = client.Get(server.URL + "/missing")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	_, err = client.Get(server.URL + "/unknown")
+	assert.Error(t, err)
+
+	// No requests should be made while replaying
+	assert.Equal(t, 3, requests)
+}
@@ -0,0 +1,142 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/fsutil"
+)
+
+// downloadState is stored alongside files downloaded by [DownloadOrRefresh]
+// to be able to revalidate them.
+type downloadState struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	CheckedAt    time.Time `json:"checkedAt"`
+}
+
+// DownloadOrRefresh writes the resource at url to the file at path. If the file
+// already exists, it's replaced if the resource has changed since it was
+// downloaded, which is checked at most once per refreshInterval. If url differs
+// from the one the file was downloaded from, the file is always replaced.
+//
+// The ETag and Last-Modified headers of the resource are stored in a hidden
+// file next to the file at path, and used to revalidate the file.
+//
+// A refreshInterval of zero disables refreshing, behaving like
+// [DownloadIfNotExist].
+//
+// If no extension is specified in path, the extension will be modified to
+// mirror that of the resource at url, or its content type.
+//
+// The file is written atomically, meaning it's never left partially written.
+func DownloadOrRefresh(ctx context.Context, path string, url string, refreshInterval time.Duration) error {
+	if refreshInterval <= 0 {
+		return DownloadIfNotExist(ctx, path, url)
+	}
+
+	path, hasExtension, err := resolveExtension(path, url)
+	if err != nil {
+		return err
+	}
+
+	exists := false
+	if hasExtension {
+		exists, err = fileExists(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Ignore invalid or missing state, it will be replaced
+	state, _ := readDownloadState(path)
+	if state != nil && state.URL != url {
+		state = nil
+	}
+
+	if exists && state != nil && time.Since(state.CheckedAt) < refreshInterval {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	if exists && state != nil {
+		if state.ETag != "" {
+			req.Header.Set("If-None-Match", state.ETag)
+		}
+		if state.LastModified != "" {
+			req.Header.Set("If-Modified-Since", state.LastModified)
+		}
+	}
+
+	res, err := DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		if !exists || state == nil {
+			return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+		}
+
+		state.CheckedAt = time.Now()
+		return writeDownloadState(path, state)
+	case http.StatusOK:
+		if !hasExtension {
+			path += ExtensionByContentType(res.Header.Get("Content-Type"))
+		}
+
+		if err := fsutil.WriteFileAtomic(path, res.Body, 0644); err != nil {
+			return err
+		}
+
+		return writeDownloadState(path, &downloadState{
+			URL:          url,
+			ETag:         res.Header.Get("ETag"),
+			LastModified: res.Header.Get("Last-Modified"),
+			CheckedAt:    time.Now(),
+		})
+	default:
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+}
+
+// downloadStatePath returns the path to the state of the file at path.
+func downloadStatePath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".http.json")
+}
+
+func readDownloadState(path string) (*downloadState, error) {
+	content, err := os.ReadFile(downloadStatePath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var state downloadState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func writeDownloadState(path string, state *downloadState) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(downloadStatePath(path), bytes.NewReader(content), 0644)
+}
@@ -0,0 +1,100 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadOrRefresh(t *testing.T) {
+	etag := `"v1"`
+	content := "v1"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cover")
+	url := server.URL + "/image.jpg?preset=2048x2048"
+
+	assertContent := func(expected string) {
+		actual, err := os.ReadFile(path + ".jpg")
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(actual))
+	}
+
+	// Initial download
+	require.NoError(t, DownloadOrRefresh(context.TODO(), path, url, time.Hour))
+	assertContent("v1")
+	assert.Equal(t, 1, requests)
+
+	// Within the refresh interval
+	require.NoError(t, DownloadOrRefresh(context.TODO(), path, url, time.Hour))
+	assert.Equal(t, 1, requests)
+
+	// Refreshing without changes
+	require.NoError(t, DownloadOrRefresh(context.TODO(), path, url, time.Nanosecond))
+	assertContent("v1")
+	assert.Equal(t, 2, requests)
+
+	// Refreshing with changes
+	etag = `"v2"`
+	content = "v2"
+	require.NoError(t, DownloadOrRefresh(context.TODO(), path, url, time.Nanosecond))
+	assertContent("v2")
+	assert.Equal(t, 3, requests)
+
+	// Changed URLs are always downloaded
+	content = "v3"
+	require.NoError(t, DownloadOrRefresh(context.TODO(), path, url+"&v=3", time.Hour))
+	assertContent("v3")
+	assert.Equal(t, 4, requests)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{".cover.jpg.http.json", "cover.jpg"}, names)
+}
+
+func TestDownloadOrRefreshAudioSibling(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Episode.m4a"), []byte("audio"), 0644))
+
+	// The episode's audio file shares the name of its image, but is not an image
+	require.NoError(t, DownloadOrRefresh(context.TODO(), filepath.Join(dir, "Episode"), server.URL+"/image", time.Hour))
+
+	content, err := os.ReadFile(filepath.Join(dir, "Episode.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(content))
+
+	content, err = os.ReadFile(filepath.Join(dir, "Episode.m4a"))
+	require.NoError(t, err)
+	assert.Equal(t, "audio", string(content))
+
+	_, err = os.Stat(filepath.Join(dir, ".Episode.m4a.http.json"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,454 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// containerBoxes are boxes that only contain other boxes.
+var containerBoxes = map[string]bool{
+	"moov": true,
+	"trak": true,
+	"mdia": true,
+	"minf": true,
+	"stbl": true,
+	"udta": true,
+	"dinf": true,
+	"edts": true,
+	"mvex": true,
+	"moof": true,
+	"traf": true,
+	"mfra": true,
+	"tref": true,
+	"sinf": true,
+	"schi": true,
+	"meta": true,
+	// The items of an ilst box are kept as leaves, see [ParseMetadata]
+	"ilst": true,
+}
+
+// fullBoxes are boxes that start with a version and flags.
+var fullBoxes = map[string]bool{
+	"meta": true,
+	"mvhd": true,
+	"tkhd": true,
+	"mdhd": true,
+	"hdlr": true,
+	"smhd": true,
+	"vmhd": true,
+	"nmhd": true,
+	"dref": true,
+	"stsd": true,
+	"stts": true,
+	"ctts": true,
+	"stsc": true,
+	"stsz": true,
+	"stz2": true,
+	"stco": true,
+	"co64": true,
+	"stss": true,
+	"elst": true,
+	"sgpd": true,
+	"sbgp": true,
+	"mehd": true,
+	"trex": true,
+	"mfhd": true,
+	"tfhd": true,
+	"tfdt": true,
+	"trun": true,
+}
+
+// maxBoxDepth is the maximum depth of nested boxes. Real files rarely nest
+// boxes more than ten levels deep, deeper files are considered malicious.
+const maxBoxDepth = 32
+
+// lazyBoxSize is the size of leaf boxes from which the content is not read
+// when parsing. Instead, the content is read from the source when written.
+const lazyBoxSize = 1 << 20
+
+// Box is a box, or atom, of an MP4 file.
+//
+// SEE: ISO/IEC 14496-12.
+type Box struct {
+	// Type is the box's four character type, such as "moov".
+	Type string
+	// FullBox is whether or not the box starts with a version and flags.
+	FullBox bool
+	Version uint8
+	// Flags are the 24-bit flags of a full box.
+	Flags uint32
+	// LargeSize is whether or not the box's size is written as a 64-bit
+	// "largesize". Boxes too large for a 32-bit size are always written using
+	// a largesize.
+	LargeSize bool
+	// Children are the boxes contained in a container box.
+	Children []*Box
+	// Data is the content of a leaf box, excluding the header, version and
+	// flags.
+	Data []byte
+	// Offset is the offset of the box in the parsed file, or -1 for boxes that
+	// were not parsed.
+	Offset int64
+
+	// source is the content of a large leaf box, which is read from the
+	// parsed file when needed.
+	source *io.SectionReader
+}
+
+// NewBox returns a new leaf box. Full boxes, such as "hdlr", are created with
+// version 0 and no flags.
+func NewBox(boxType string, data []byte) *Box {
+	return &Box{
+		Type:    boxType,
+		FullBox: fullBoxes[boxType],
+		Data:    data,
+		Offset:  -1,
+	}
+}
+
+// NewContainer returns a new container box.
+func NewContainer(boxType string, children ...*Box) *Box {
+	return &Box{
+		Type:     boxType,
+		FullBox:  fullBoxes[boxType],
+		Children: children,
+		Offset:   -1,
+	}
+}
+
+// IsContainer returns whether or not the box contains other boxes.
+func (b *Box) IsContainer() bool {
+	return containerBoxes[b.Type]
+}
+
+// Find returns the first box matching the path of box types, relative to b.
+// Returns nil if there is no such box.
+func (b *Box) Find(path ...string) *Box {
+	return findBox(b.Children, path)
+}
+
+// Content returns the content of a leaf box, reading it from the parsed file
+// if necessary.
+func (b *Box) Content() ([]byte, error) {
+	if b.source == nil {
+		return b.Data, nil
+	}
+
+	content := make([]byte, b.source.Size())
+	if err := readAt(b.source, content, 0); err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// contentSize returns the size of the box's content, excluding the header,
+// version and flags.
+func (b *Box) contentSize() int64 {
+	if b.source != nil {
+		return b.source.Size()
+	}
+
+	if b.IsContainer() {
+		var size int64
+		for _, child := range b.Children {
+			size += child.Size()
+		}
+		return size
+	}
+
+	return int64(len(b.Data))
+}
+
+// isLarge returns whether or not the box's size is written as a largesize.
+func (b *Box) isLarge(contentSize int64) bool {
+	// Leave room for the largest possible header
+	return b.LargeSize || contentSize > math.MaxUint32-20
+}
+
+// headerSize returns the size of the box's header, including the version and
+// flags of full boxes.
+func (b *Box) headerSize(contentSize int64) int64 {
+	size := int64(8)
+	if b.FullBox {
+		size += 4
+	}
+
+	if b.isLarge(contentSize) {
+		size += 8
+	}
+
+	return size
+}
+
+// Size returns the size of the serialized box.
+func (b *Box) Size() int64 {
+	contentSize := b.contentSize()
+	return b.headerSize(contentSize) + contentSize
+}
+
+// WriteTo implements [io.WriterTo], writing the serialized box to w.
+func (b *Box) WriteTo(w io.Writer) (int64, error) {
+	contentSize := b.contentSize()
+	headerSize := b.headerSize(contentSize)
+
+	header := make([]byte, 0, 20)
+	if b.isLarge(contentSize) {
+		header = binary.BigEndian.AppendUint32(header, 1)
+		header = append(header, b.Type...)
+		header = binary.BigEndian.AppendUint64(header, uint64(headerSize+contentSize))
+	} else {
+		header = binary.BigEndian.AppendUint32(header, uint32(headerSize+contentSize))
+		header = append(header, b.Type...)
+	}
+
+	if b.FullBox {
+		header = binary.BigEndian.AppendUint32(header, uint32(b.Version)<<24|b.Flags&0x00ffffff)
+	}
+
+	n, err := w.Write(header)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	switch {
+	case b.source != nil:
+		n, err := io.Copy(w, io.NewSectionReader(b.source, 0, b.source.Size()))
+		written += n
+		if err != nil {
+			return written, err
+		}
+	case b.IsContainer():
+		for _, child := range b.Children {
+			n, err := child.WriteTo(w)
+			written += n
+			if err != nil {
+				return written, err
+			}
+		}
+	default:
+		n, err := w.Write(b.Data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// Bytes returns the serialized box.
+func (b *Box) Bytes() ([]byte, error) {
+	var buffer bytes.Buffer
+	if _, err := b.WriteTo(&buffer); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// File is the box tree of an MP4 file.
+type File struct {
+	Boxes []*Box
+}
+
+// Parse parses the box tree of the MP4 file r of the specified size. The
+// content of large leaf boxes, such as mdat, is read from r when needed, so r
+// must not be modified while the file is used.
+func Parse(r io.ReaderAt, size int64) (*File, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("invalid size %d", size)
+	}
+
+	boxes, err := parseBoxes(r, 0, size, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{Boxes: boxes}, nil
+}
+
+// Find returns the first box matching the path of box types, such as
+// "moov", "udta". Returns nil if there is no such box.
+func (f *File) Find(path ...string) *Box {
+	return findBox(f.Boxes, path)
+}
+
+// Index returns the index of the first top-level box of type boxType, or -1
+// if there is no such box.
+func (f *File) Index(boxType string) int {
+	for i, box := range f.Boxes {
+		if box.Type == boxType {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// WriteTo implements [io.WriterTo], writing the serialized file to w.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for _, box := range f.Boxes {
+		n, err := box.WriteTo(w)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+func findBox(boxes []*Box, path []string) *Box {
+	if len(path) == 0 {
+		return nil
+	}
+
+	for _, box := range boxes {
+		if box.Type != path[0] {
+			continue
+		}
+
+		if len(path) == 1 {
+			return box
+		}
+
+		if found := box.Find(path[1:]...); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// parseBoxes parses all boxes between offset and end, nested depth boxes deep.
+func parseBoxes(r io.ReaderAt, offset int64, end int64, depth int) ([]*Box, error) {
+	if depth > maxBoxDepth {
+		return nil, fmt.Errorf("boxes nested too deep at offset %d", offset)
+	}
+
+	boxes := make([]*Box, 0)
+	for offset < end {
+		if end-offset < 8 {
+			return nil, fmt.Errorf("truncated box header at offset %d", offset)
+		}
+
+		var header [16]byte
+		if err := readAt(r, header[:8], offset); err != nil {
+			return nil, err
+		}
+
+		box := &Box{
+			Type:   string(header[4:8]),
+			Offset: offset,
+		}
+
+		boxSize := int64(binary.BigEndian.Uint32(header[0:4]))
+		headerSize := int64(8)
+		switch boxSize {
+		case 0:
+			// The box extends to the end of the file. Nested boxes must have an
+			// explicit size
+			if depth > 0 {
+				return nil, fmt.Errorf("invalid size 0 of nested box %q at offset %d", boxTypeString(box.Type), offset)
+			}
+			boxSize = end - offset
+		case 1:
+			// The size is stored as a 64-bit "largesize" after the type
+			if end-offset < 16 {
+				return nil, fmt.Errorf("truncated box header at offset %d", offset)
+			}
+			if err := readAt(r, header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			largeSize := binary.BigEndian.Uint64(header[8:16])
+			if largeSize > uint64(end-offset) {
+				return nil, fmt.Errorf("invalid size %d of box %q at offset %d", largeSize, boxTypeString(box.Type), offset)
+			}
+			boxSize = int64(largeSize)
+			headerSize = 16
+			box.LargeSize = true
+		}
+
+		if boxSize < headerSize || boxSize > end-offset {
+			return nil, fmt.Errorf("invalid size %d of box %q at offset %d", boxSize, boxTypeString(box.Type), offset)
+		}
+
+		contentOffset := offset + headerSize
+		contentEnd := offset + boxSize
+
+		box.FullBox = fullBoxes[box.Type]
+		if box.Type == "meta" && isQuickTimeMeta(r, contentOffset, contentEnd) {
+			// QuickTime's meta box is a plain container
+			box.FullBox = false
+		}
+
+		if box.FullBox {
+			if contentEnd-contentOffset < 4 {
+				return nil, fmt.Errorf("truncated full box %q at offset %d", boxTypeString(box.Type), offset)
+			}
+
+			var versionAndFlags [4]byte
+			if err := readAt(r, versionAndFlags[:], contentOffset); err != nil {
+				return nil, err
+			}
+			box.Version = versionAndFlags[0]
+			box.Flags = binary.BigEndian.Uint32(versionAndFlags[:]) & 0x00ffffff
+			contentOffset += 4
+		}
+
+		switch {
+		case box.IsContainer():
+			children, err := parseBoxes(r, contentOffset, contentEnd, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			box.Children = children
+		case box.Type == "mdat" || contentEnd-contentOffset > lazyBoxSize:
+			box.source = io.NewSectionReader(r, contentOffset, contentEnd-contentOffset)
+		default:
+			box.Data = make([]byte, contentEnd-contentOffset)
+			if err := readAt(r, box.Data, contentOffset); err != nil {
+				return nil, err
+			}
+		}
+
+		boxes = append(boxes, box)
+		offset = contentEnd
+	}
+
+	return boxes, nil
+}
+
+// isQuickTimeMeta returns whether or not the meta box with the content
+// between offset and end is a QuickTime meta box, which unlike ISO's meta box
+// lacks a version and flags. Its first child is expected to be a hdlr box.
+func isQuickTimeMeta(r io.ReaderAt, offset int64, end int64) bool {
+	if end-offset < 8 {
+		return false
+	}
+
+	var header [8]byte
+	if err := readAt(r, header[:], offset); err != nil {
+		return false
+	}
+
+	return string(header[4:8]) == "hdlr"
+}
+
+// readAt reads exactly len(b) bytes from r at offset. Short reads are retried
+// and reading past the end of r is an error.
+func readAt(r io.ReaderAt, b []byte, offset int64) error {
+	_, err := io.ReadFull(io.NewSectionReader(r, offset, int64(len(b))), b)
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,217 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWrite(t *testing.T) {
+	content, err := os.ReadFile("./empty.m4a")
+	require.NoError(t, err)
+
+	file, err := Parse(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	types := make([]string, 0)
+	for _, box := range file.Boxes {
+		types = append(types, box.Type)
+	}
+	assert.Equal(t, []string{"ftyp", "free", "mdat", "moov"}, types)
+
+	stco := file.Find("moov", "trak", "mdia", "minf", "stbl", "stco")
+	require.NotNil(t, stco)
+	assert.True(t, stco.FullBox)
+	assert.Equal(t, int64(748), stco.Offset)
+
+	hdlr := file.Find("moov", "udta", "meta", "hdlr")
+	require.NotNil(t, hdlr)
+	assert.Equal(t, "mdir", string(hdlr.Data[4:8]))
+
+	var buffer bytes.Buffer
+	n, err := file.WriteTo(&buffer)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	assert.Equal(t, content, buffer.Bytes())
+}
+
+func TestParseLargeSize(t *testing.T) {
+	var content []byte
+	content = append(content, rawBox("ftyp", []byte("M4A \x00\x00\x02\x00"))...)
+
+	// A free box with a 64-bit size
+	content = binary.BigEndian.AppendUint32(content, 1)
+	content = append(content, "free"...)
+	content = binary.BigEndian.AppendUint64(content, 20)
+	content = append(content, "abcd"...)
+
+	// An mdat box extending to the end of the file
+	content = append(content, "\x00\x00\x00\x00mdat0123456789"...)
+
+	file, err := Parse(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	require.Len(t, file.Boxes, 3)
+
+	free := file.Boxes[1]
+	assert.True(t, free.LargeSize)
+	assert.Equal(t, []byte("abcd"), free.Data)
+	assert.Equal(t, int64(20), free.Size())
+
+	mdat := file.Boxes[2]
+	mdatContent, err := mdat.Content()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("0123456789"), mdatContent)
+
+	// The size of boxes extending to the end of the file is written explicitly
+	var buffer bytes.Buffer
+	_, err = file.WriteTo(&buffer)
+	require.NoError(t, err)
+	assert.Equal(t, len(content), buffer.Len())
+	assert.Equal(t, "\x00\x00\x00\x12mdat0123456789", buffer.String()[len(content)-18:])
+}
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Content string
+	}{
+		{
+			Name:    "truncated header",
+			Content: "\x00\x00\x00",
+		},
+		{
+			Name:    "size too small",
+			Content: "\x00\x00\x00\x04free",
+		},
+		{
+			Name:    "size too large",
+			Content: "\x00\x00\x00\xfffree",
+		},
+		{
+			Name:    "largesize too large",
+			Content: "\x00\x00\x00\x01free\x00\x00\x00\x00\x00\x00\x00\xff",
+		},
+		{
+			Name:    "truncated full box",
+			Content: "\x00\x00\x00\x12moov\x00\x00\x00\x0atkhd\x00\x00",
+		},
+		{
+			Name:    "zero size nested box",
+			Content: "\x00\x00\x00\x10moov\x00\x00\x00\x00trak",
+		},
+		{
+			Name:    "nested too deep",
+			Content: string(nestedBoxes(maxBoxDepth + 2)),
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			_, err := Parse(bytes.NewReader([]byte(testCase.Content)), int64(len(testCase.Content)))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseQuickTimeMeta(t *testing.T) {
+	// QuickTime's meta box lacks a version and flags
+	content := rawBox("moov", rawBox("udta", rawBox("meta", append(
+		rawBox("hdlr", make([]byte, 25)),
+		rawBox("ilst", rawBox("\xa9nam", rawBox("data", []byte("\x00\x00\x00\x01\x00\x00\x00\x00Title"))))...,
+	))))
+
+	file, err := Parse(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	meta := file.Find("moov", "udta", "meta")
+	require.NotNil(t, meta)
+	assert.False(t, meta.FullBox)
+	assert.NotNil(t, meta.Find("ilst", "\xa9nam"))
+
+	metadata, err := ReadMetadata(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	assert.Equal(t, "Title", metadata.Title)
+}
+
+func TestMetadataWriteCreatesContainers(t *testing.T) {
+	// Remove the udta box of the file
+	content, err := os.ReadFile("./empty.m4a")
+	require.NoError(t, err)
+
+	file, err := Parse(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	moov := file.Find("moov")
+	moov.Children = moov.Children[:len(moov.Children)-1]
+	require.Nil(t, file.Find("moov", "udta"))
+
+	var buffer bytes.Buffer
+	_, err = file.WriteTo(&buffer)
+	require.NoError(t, err)
+
+	target := filepath.Join(t.TempDir(), "without-udta.m4a")
+	require.NoError(t, os.WriteFile(target, buffer.Bytes(), 0644))
+
+	f, err := os.OpenFile(target, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	metadata := Metadata{Title: "Title"}
+	require.NoError(t, metadata.Write(f))
+
+	actual, err := readMetadataFromFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, &metadata, actual)
+
+	// The audio is untouched
+	written, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, content[:109], written[:109])
+}
+
+// rawBox returns the serialized box of the specified type and content.
+func TestParseShortReads(t *testing.T) {
+	content, err := os.ReadFile("./empty.m4a")
+	require.NoError(t, err)
+
+	file, err := Parse(shortReader{bytes.NewReader(content)}, int64(len(content)))
+	require.NoError(t, err)
+
+	var buffer bytes.Buffer
+	_, err = file.WriteTo(&buffer)
+	require.NoError(t, err)
+	assert.Equal(t, content, buffer.Bytes())
+}
+
+// shortReader reads at most one byte at a time, like a slow network stream.
+type shortReader struct {
+	r io.ReaderAt
+}
+
+func (r shortReader) ReadAt(b []byte, offset int64) (int, error) {
+	if len(b) > 1 {
+		b = b[:1]
+	}
+	return r.r.ReadAt(b, offset)
+}
+
+// nestedBoxes returns depth moov boxes, each nested in the previous one.
+func nestedBoxes(depth int) []byte {
+	var content []byte
+	for range depth {
+		content = rawBox("moov", content)
+	}
+	return content
+}
+
+func rawBox(boxType string, content []byte) []byte {
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(content)))
+	box = append(box, boxType...)
+	return append(box, content...)
+}
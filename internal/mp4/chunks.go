@@ -0,0 +1,153 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// chunkOffsetTable is the content of a stco or co64 box, which contains the
+// absolute offsets of a track's chunks of media data.
+type chunkOffsetTable struct {
+	box *Box
+	// offsets are the offsets as parsed, before being shifted.
+	offsets []uint64
+}
+
+// chunkOffsetTables returns the chunk offset tables of all tracks in moov.
+func chunkOffsetTables(moov *Box) ([]*chunkOffsetTable, error) {
+	tables := make([]*chunkOffsetTable, 0)
+	for _, trak := range moov.Children {
+		if trak.Type != "trak" {
+			continue
+		}
+
+		stbl := trak.Find("mdia", "minf", "stbl")
+		if stbl == nil {
+			continue
+		}
+
+		for _, box := range stbl.Children {
+			if box.Type != "stco" && box.Type != "co64" {
+				continue
+			}
+
+			table, err := parseChunkOffsetTable(box)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, table)
+		}
+	}
+
+	return tables, nil
+}
+
+// parseChunkOffsetTable parses a stco or co64 box. Tables of long files may
+// be large enough to not have been read when parsed.
+func parseChunkOffsetTable(box *Box) (*chunkOffsetTable, error) {
+	width := 4
+	if box.Type == "co64" {
+		width = 8
+	}
+
+	content, err := box.Content()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) < 4 {
+		return nil, fmt.Errorf("truncated %s box", box.Type)
+	}
+
+	count := binary.BigEndian.Uint32(content[0:4])
+	if uint64(count)*uint64(width) > uint64(len(content)-4) {
+		return nil, fmt.Errorf("invalid entry count %d of %s box", count, box.Type)
+	}
+
+	offsets := make([]uint64, count)
+	for i := range offsets {
+		entry := content[4+i*width:]
+		if width == 4 {
+			offsets[i] = uint64(binary.BigEndian.Uint32(entry))
+		} else {
+			offsets[i] = binary.BigEndian.Uint64(entry)
+		}
+	}
+
+	return &chunkOffsetTable{box: box, offsets: offsets}, nil
+}
+
+// shift moves all parsed offsets at or after from by delta, updating the box.
+// A stco box is upgraded to a co64 box if the shifted offsets don't fit 32
+// bits. Returns whether or not the box was upgraded, changing its size.
+func (t *chunkOffsetTable) shift(from int64, delta int64) (bool, error) {
+	shifted := make([]uint64, len(t.offsets))
+	upgrade := false
+	for i, offset := range t.offsets {
+		shifted[i] = offset
+		if offset >= uint64(from) {
+			if delta < 0 && uint64(-delta) > offset {
+				return false, fmt.Errorf("invalid chunk offset %d", offset)
+			}
+			shifted[i] = uint64(int64(offset) + delta)
+		}
+
+		if shifted[i] > math.MaxUint32 {
+			upgrade = true
+		}
+	}
+
+	upgraded := upgrade && t.box.Type == "stco"
+	if upgraded {
+		t.box.Type = "co64"
+	}
+
+	width := 4
+	if t.box.Type == "co64" {
+		width = 8
+	}
+
+	data := make([]byte, 4, 4+len(shifted)*width)
+	binary.BigEndian.PutUint32(data, uint32(len(shifted)))
+	for _, offset := range shifted {
+		if width == 4 {
+			data = binary.BigEndian.AppendUint32(data, uint32(offset))
+		} else {
+			data = binary.BigEndian.AppendUint64(data, offset)
+		}
+	}
+	t.box.Data = data
+	// The content is no longer read from the parsed file
+	t.box.source = nil
+
+	return upgraded, nil
+}
+
+// shiftChunkOffsets updates the chunk offsets of moov, which had the specified
+// size and ended at end when parsed, to account for moov's change in size.
+// Media data after moov moves by the same amount as moov grows or shrinks.
+func shiftChunkOffsets(moov *Box, size int64, end int64) error {
+	tables, err := chunkOffsetTables(moov)
+	if err != nil {
+		return err
+	}
+
+	// Upgrading a table to co64 grows moov further, so repeat until the size is
+	// stable. Tables are upgraded at most once, so this terminates
+	for {
+		delta := moov.Size() - size
+		upgraded := false
+		for _, table := range tables {
+			tableUpgraded, err := table.shift(end, delta)
+			if err != nil {
+				return err
+			}
+			upgraded = upgraded || tableUpgraded
+		}
+
+		if !upgraded {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataWriteLayouts(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Create func(t *testing.T) []byte
+	}{
+		{
+			Name: "moov after mdat",
+			Create: func(t *testing.T) []byte {
+				content, err := os.ReadFile("./empty.m4a")
+				require.NoError(t, err)
+				return content
+			},
+		},
+		{
+			Name:   "moov before mdat",
+			Create: createFastStartFile,
+		},
+		{
+			Name:   "moov before mdat with large chunk offset table",
+			Create: createLargeChunkOffsetTableFile,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			content := testCase.Create(t)
+			expectedChunks := readChunks(t, content)
+			require.NotEmpty(t, expectedChunks)
+
+			target := filepath.Join(t.TempDir(), "file.m4a")
+			require.NoError(t, os.WriteFile(target, content, 0644))
+
+			file, err := os.OpenFile(target, os.O_RDWR, 0)
+			require.NoError(t, err)
+			defer file.Close()
+
+			// Grow the metadata
+			metadata := Metadata{
+				Title:       "A very long title for testing",
+				Description: "Some description",
+			}
+			require.NoError(t, metadata.Write(file))
+
+			written, err := os.ReadFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, expectedChunks, readChunks(t, written))
+
+			// Shrink the metadata
+			require.NoError(t, Metadata{}.Write(file))
+
+			written, err = os.ReadFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, expectedChunks, readChunks(t, written))
+		})
+	}
+}
+
+func TestShiftChunkOffsetsUpgrade(t *testing.T) {
+	data := binary.BigEndian.AppendUint32(nil, 2)
+	data = binary.BigEndian.AppendUint32(data, 100)
+	data = binary.BigEndian.AppendUint32(data, math.MaxUint32-4)
+
+	stco := NewBox("stco", data)
+	moov := NewContainer("moov",
+		NewContainer("trak",
+			NewContainer("mdia",
+				NewContainer("minf",
+					NewContainer("stbl", stco),
+				),
+			),
+		),
+	)
+
+	// Pretend that moov grew by 10 bytes, with media data starting at 50
+	require.NoError(t, shiftChunkOffsets(moov, moov.Size()-10, 50))
+
+	// The upgrade to co64 grows moov by another 8 bytes
+	assert.Equal(t, "co64", stco.Type)
+	expected := binary.BigEndian.AppendUint32(nil, 2)
+	expected = binary.BigEndian.AppendUint64(expected, 118)
+	expected = binary.BigEndian.AppendUint64(expected, math.MaxUint32-4+18)
+	assert.Equal(t, expected, stco.Data)
+}
+
+// createFastStartFile returns the content of empty.m4a with moov moved before
+// mdat, like files optimized for streaming.
+func createFastStartFile(t *testing.T) []byte {
+	content, err := os.ReadFile("./empty.m4a")
+	require.NoError(t, err)
+
+	file, err := Parse(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	mdatIndex := file.Index("mdat")
+	moovIndex := file.Index("moov")
+	require.Equal(t, mdatIndex+1, moovIndex)
+
+	moov := file.Boxes[moovIndex]
+	file.Boxes[mdatIndex], file.Boxes[moovIndex] = moov, file.Boxes[mdatIndex]
+
+	// Move the chunks by the size of moov
+	stco := moov.Find("trak", "mdia", "minf", "stbl", "stco")
+	require.NotNil(t, stco)
+	table, err := parseChunkOffsetTable(stco)
+	require.NoError(t, err)
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(table.offsets)))
+	for _, offset := range table.offsets {
+		data = binary.BigEndian.AppendUint32(data, uint32(offset+uint64(moov.Size())))
+	}
+	stco.Data = data
+
+	var buffer bytes.Buffer
+	_, err = file.WriteTo(&buffer)
+	require.NoError(t, err)
+	return buffer.Bytes()
+}
+
+// createLargeChunkOffsetTableFile returns the content of a fast start file
+// with a stco box that is large enough to not be read when parsed.
+func createLargeChunkOffsetTableFile(t *testing.T) []byte {
+	content := createFastStartFile(t)
+
+	file, err := Parse(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	stco := file.Find("moov", "trak", "mdia", "minf", "stbl", "stco")
+	require.NotNil(t, stco)
+	table, err := parseChunkOffsetTable(stco)
+	require.NoError(t, err)
+	require.Len(t, table.offsets, 1)
+
+	// Repeat the chunk, which moves by the size of the added entries
+	count := lazyBoxSize/4 + 1
+	offset := uint32(table.offsets[0]) + uint32(4*(count-1))
+	data := binary.BigEndian.AppendUint32(nil, uint32(count))
+	for range count {
+		data = binary.BigEndian.AppendUint32(data, offset)
+	}
+	stco.Data = data
+
+	var buffer bytes.Buffer
+	_, err = file.WriteTo(&buffer)
+	require.NoError(t, err)
+	return buffer.Bytes()
+}
+
+// readChunks returns the first bytes of each chunk of media data in the file.
+func readChunks(t *testing.T, content []byte) [][]byte {
+	file, err := Parse(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	moov := file.Find("moov")
+	require.NotNil(t, moov)
+
+	tables, err := chunkOffsetTables(moov)
+	require.NoError(t, err)
+
+	chunks := make([][]byte, 0)
+	for _, table := range tables {
+		for _, offset := range table.offsets {
+			require.Less(t, offset, uint64(len(content)))
+			chunks = append(chunks, content[offset:min(offset+16, uint64(len(content)))])
+		}
+	}
+
+	return chunks
+}
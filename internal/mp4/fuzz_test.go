@@ -0,0 +1,130 @@
+package mp4
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addSeeds adds empty.m4a, a minimal AAC file, to the fuzzer's seed corpus,
+// both as is and with metadata written by this package. The corpus in
+// testdata/fuzz holds the same file's boxes with the media truncated, both
+// with moov after mdat and in a fast-start layout. It doesn't yet hold the
+// headers of SR's pod and broadcast files.
+func addSeeds(f *testing.F) {
+	content, err := os.ReadFile("./empty.m4a")
+	require.NoError(f, err)
+	f.Add(content)
+
+	target := filepath.Join(f.TempDir(), "with-metadata.m4a")
+	require.NoError(f, os.WriteFile(target, content, 0644))
+
+	file, err := os.OpenFile(target, os.O_RDWR, 0)
+	require.NoError(f, err)
+	defer file.Close()
+
+	metadata := Metadata{
+		Title:    "Carpe diem",
+		Podcast:  true,
+		Track:    Pair{Number: 1, Total: 2},
+		Released: time.Date(2025, 7, 20, 9, 0, 0, 0, time.UTC),
+		Freeform: []FreeformItem{{Mean: "se.sr", Name: "episode_id", Value: "2522448"}},
+	}
+	require.NoError(f, metadata.Write(file))
+
+	content, err = os.ReadFile(target)
+	require.NoError(f, err)
+	f.Add(content)
+}
+
+func FuzzParse(f *testing.F) {
+	addSeeds(f)
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		file, err := Parse(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return
+		}
+
+		// Parsed files must be written back in a form that parses the same
+		var written bytes.Buffer
+		_, err = file.WriteTo(&written)
+		require.NoError(t, err)
+
+		reparsed, err := Parse(bytes.NewReader(written.Bytes()), int64(written.Len()))
+		require.NoError(t, err)
+
+		var rewritten bytes.Buffer
+		_, err = reparsed.WriteTo(&rewritten)
+		require.NoError(t, err)
+		assert.Equal(t, written.Bytes(), rewritten.Bytes())
+
+		// Reading must never panic
+		ReadMetadata(bytes.NewReader(content), int64(len(content)))
+		ReadDuration(bytes.NewReader(content), int64(len(content)))
+		Inspect(bytes.NewReader(content), int64(len(content)))
+	})
+}
+
+func FuzzParseMetadata(f *testing.F) {
+	addSeeds(f)
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		metadata, err := ReadMetadata(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return
+		}
+
+		// Parsed metadata must be encoded in a form that parses the same
+		encoded, err := metadata.Bytes()
+		if err != nil {
+			return
+		}
+
+		reparsed, err := ParseMetadata(encoded)
+		require.NoError(t, err)
+
+		reencoded, err := reparsed.Bytes()
+		require.NoError(t, err)
+		assert.Equal(t, encoded, reencoded)
+	})
+}
+
+func FuzzMetadataWrite(f *testing.F) {
+	addSeeds(f)
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		if _, err := Parse(bytes.NewReader(content), int64(len(content))); err != nil {
+			return
+		}
+
+		target := filepath.Join(t.TempDir(), "fuzz.m4a")
+		require.NoError(t, os.WriteFile(target, content, 0644))
+
+		file, err := os.OpenFile(target, os.O_RDWR, 0)
+		require.NoError(t, err)
+		defer file.Close()
+
+		metadata := Metadata{
+			Title:    "Carpe diem",
+			Freeform: []FreeformItem{{Mean: "se.sr", Name: "episode_id", Value: "2522448"}},
+		}
+		if err := metadata.Write(file); err != nil {
+			return
+		}
+
+		stat, err := file.Stat()
+		require.NoError(t, err)
+
+		// Written metadata must be read back as is
+		read, err := ReadMetadata(file, stat.Size())
+		require.NoError(t, err)
+		assert.Equal(t, metadata.Title, read.Title)
+		assert.Equal(t, metadata.Freeform, read.Freeform)
+	})
+}
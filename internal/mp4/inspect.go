@@ -0,0 +1,481 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// samplingFrequencies are the sampling frequencies of MPEG-4 audio, by their
+// index in an AudioSpecificConfig.
+//
+// SEE: ISO/IEC 14496-3, 1.6.3.4.
+var samplingFrequencies = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// Well-known MPEG-4 audio object types.
+// SEE: ISO/IEC 14496-3, 1.5.1.1.
+const (
+	AudioObjectTypeAACMain = 1
+	AudioObjectTypeAACLC   = 2
+	AudioObjectTypeSBR     = 5
+	AudioObjectTypePS      = 29
+)
+
+// audioObjectTypeNames are the names of common MPEG-4 audio object types.
+var audioObjectTypeNames = map[int]string{
+	AudioObjectTypeAACMain: "AAC Main",
+	AudioObjectTypeAACLC:   "AAC LC",
+	3:                      "AAC SSR",
+	4:                      "AAC LTP",
+	AudioObjectTypeSBR:     "HE-AAC",
+	23:                     "AAC LD",
+	AudioObjectTypePS:      "HE-AAC v2",
+	39:                     "AAC ELD",
+}
+
+// AudioObjectTypeName returns the name of the MPEG-4 audio object type, such
+// as "AAC LC". Returns an empty string for unknown types.
+func AudioObjectTypeName(objectType int) string {
+	return audioObjectTypeNames[objectType]
+}
+
+// Inspection describes the structure and content of an MP4 file.
+type Inspection struct {
+	// Boxes are the file's top-level boxes.
+	Boxes []BoxInfo `json:"boxes"`
+	// Tracks are the file's tracks, in the order of their trak boxes.
+	Tracks []Track `json:"tracks"`
+	// Duration is the duration of the movie, or zero if unknown.
+	Duration time.Duration `json:"-"`
+	// Bitrate is the average bitrate of the media data in bits per second, or
+	// zero if unknown.
+	Bitrate int `json:"bitrate"`
+	// Metadata is the file's metadata.
+	Metadata *Metadata `json:"metadata"`
+}
+
+// MarshalJSON implements [json.Marshaler]. The duration is encoded in seconds.
+func (i Inspection) MarshalJSON() ([]byte, error) {
+	type inspection Inspection
+	return json.Marshal(struct {
+		inspection
+		Duration float64 `json:"duration"`
+	}{
+		inspection: inspection(i),
+		Duration:   i.Duration.Seconds(),
+	})
+}
+
+// BoxInfo describes a box and its position in the file.
+type BoxInfo struct {
+	// Type is the box's type, decoded as Latin-1.
+	Type string `json:"type"`
+	// Offset is the offset of the box in the file.
+	Offset int64 `json:"offset"`
+	// Size is the size of the box, including its header.
+	Size     int64     `json:"size"`
+	Children []BoxInfo `json:"children,omitempty"`
+}
+
+// Track describes a track of an MP4 file. Values that are not specified by
+// the file are left as zero values.
+type Track struct {
+	ID int `json:"id"`
+	// Handler is the type of the track's media, such as "soun" for audio.
+	Handler string `json:"handler"`
+	// Codec is the type of the first sample entry, such as "mp4a".
+	Codec string `json:"codec"`
+	// ObjectType is the MPEG-4 audio object type of AAC tracks, such as
+	// [AudioObjectTypeAACLC].
+	ObjectType int `json:"objectType,omitempty"`
+	SampleRate int `json:"sampleRate,omitempty"`
+	Channels   int `json:"channels,omitempty"`
+	// Bitrate is the track's average bitrate in bits per second, as specified
+	// by its decoder configuration.
+	Bitrate  int           `json:"bitrate,omitempty"`
+	Duration time.Duration `json:"-"`
+}
+
+// MarshalJSON implements [json.Marshaler]. The duration is encoded in seconds.
+func (t Track) MarshalJSON() ([]byte, error) {
+	type track Track
+	return json.Marshal(struct {
+		track
+		Duration float64 `json:"duration"`
+	}{
+		track:    track(t),
+		Duration: t.Duration.Seconds(),
+	})
+}
+
+// Inspect inspects the MP4 file r of the specified size. Tracks and durations
+// are read on a best-effort basis, as the intent is to debug files. Only
+// files that cannot be parsed at all result in an error.
+func Inspect(r io.ReaderAt, size int64) (*Inspection, error) {
+	file, err := Parse(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := readMetadata(file)
+	if err != nil {
+		return nil, err
+	}
+
+	inspection := &Inspection{
+		Boxes:    inspectBoxes(file.Boxes),
+		Tracks:   make([]Track, 0),
+		Metadata: metadata,
+	}
+
+	moov := file.Find("moov")
+	if moov != nil {
+		for _, box := range moov.Children {
+			if box.Type == "trak" {
+				inspection.Tracks = append(inspection.Tracks, inspectTrack(box))
+			}
+		}
+	}
+
+	if mvhd := file.Find("moov", "mvhd"); mvhd != nil {
+		inspection.Duration, _ = parseDuration(mvhd)
+	}
+
+	if inspection.Duration > 0 {
+		var mediaSize int64
+		for _, box := range file.Boxes {
+			if box.Type == "mdat" {
+				mediaSize += box.contentSize()
+			}
+		}
+		inspection.Bitrate = int(float64(mediaSize*8) / inspection.Duration.Seconds())
+	}
+
+	return inspection, nil
+}
+
+// inspectBoxes returns the descriptions of boxes and their children.
+func inspectBoxes(boxes []*Box) []BoxInfo {
+	infos := make([]BoxInfo, 0, len(boxes))
+	for _, box := range boxes {
+		info := BoxInfo{
+			Type:   boxTypeString(box.Type),
+			Offset: box.Offset,
+			Size:   box.Size(),
+		}
+		if len(box.Children) > 0 {
+			info.Children = inspectBoxes(box.Children)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// inspectTrack returns the description of a trak box.
+func inspectTrack(trak *Box) Track {
+	var track Track
+
+	// The track id follows the creation and modification times
+	if tkhd := trak.Find("tkhd"); tkhd != nil {
+		switch {
+		case tkhd.Version == 0 && len(tkhd.Data) >= 12:
+			track.ID = int(binary.BigEndian.Uint32(tkhd.Data[8:12]))
+		case tkhd.Version == 1 && len(tkhd.Data) >= 20:
+			track.ID = int(binary.BigEndian.Uint32(tkhd.Data[16:20]))
+		}
+	}
+
+	// The handler type follows the pre-defined field
+	if hdlr := trak.Find("mdia", "hdlr"); hdlr != nil && len(hdlr.Data) >= 8 {
+		track.Handler = boxTypeString(string(hdlr.Data[4:8]))
+	}
+
+	if mdhd := trak.Find("mdia", "mdhd"); mdhd != nil {
+		track.Duration, _ = parseDuration(mdhd)
+	}
+
+	stsd := trak.Find("mdia", "minf", "stbl", "stsd")
+	if stsd == nil {
+		return track
+	}
+
+	// The sample entries follow the entry count. Large entries may not have
+	// been read when parsed
+	content, err := stsd.Content()
+	if err != nil || len(content) < 4 {
+		return track
+	}
+
+	entrySize, entryType, err := parseBoxHeader(content[4:])
+	if err != nil {
+		return track
+	}
+	track.Codec = boxTypeString(entryType)
+
+	if track.Handler == "soun" {
+		inspectAudioSampleEntry(&track, content[4+8:4+entrySize])
+	}
+
+	return track
+}
+
+// inspectAudioSampleEntry sets the codec info of track from the content of
+// an audio sample entry, such as mp4a.
+//
+// SEE: ISO/IEC 14496-12, 12.2.3.
+func inspectAudioSampleEntry(track *Track, entry []byte) {
+	// The reserved fields and data reference index, the version, revision and
+	// vendor of QuickTime's sound descriptions, the channel count, sample size,
+	// compression id, packet size and 16.16 sample rate
+	if len(entry) < 28 {
+		return
+	}
+
+	track.Channels = int(binary.BigEndian.Uint16(entry[16:18]))
+	track.SampleRate = int(binary.BigEndian.Uint16(entry[24:26]))
+
+	// QuickTime's version 1 and 2 sound descriptions have additional fields
+	// before the child boxes
+	children := entry[28:]
+	switch binary.BigEndian.Uint16(entry[8:10]) {
+	case 1:
+		if len(children) < 16 {
+			return
+		}
+		children = children[16:]
+	case 2:
+		if len(children) < 36 {
+			return
+		}
+		children = children[36:]
+	}
+
+	for len(children) > 0 {
+		boxSize, boxType, err := parseBoxHeader(children)
+		if err != nil {
+			return
+		}
+
+		// Skip the version and flags
+		if boxType == "esds" && boxSize >= 12 {
+			inspectElementaryStreamDescriptor(track, children[12:boxSize])
+		}
+
+		children = children[boxSize:]
+	}
+}
+
+// inspectElementaryStreamDescriptor sets the codec info of track from the
+// content of an esds box.
+//
+// SEE: ISO/IEC 14496-1, 7.2.6.
+func inspectElementaryStreamDescriptor(track *Track, esds []byte) {
+	tag, content, _, ok := parseDescriptor(esds)
+	if !ok || tag != 0x03 || len(content) < 3 {
+		return
+	}
+
+	// The ES_ID is followed by flags of optional fields
+	flags := content[2]
+	content = content[3:]
+	if flags&0x80 != 0 {
+		// The id of the stream the stream depends on
+		if len(content) < 2 {
+			return
+		}
+		content = content[2:]
+	}
+	if flags&0x40 != 0 {
+		// A length prefixed URL
+		if len(content) < 1 || len(content) < 1+int(content[0]) {
+			return
+		}
+		content = content[1+int(content[0]):]
+	}
+	if flags&0x20 != 0 {
+		// The id of the OCR stream
+		if len(content) < 2 {
+			return
+		}
+		content = content[2:]
+	}
+
+	for len(content) > 0 {
+		tag, decoderConfig, rest, ok := parseDescriptor(content)
+		if !ok {
+			return
+		}
+		content = rest
+
+		if tag != 0x04 {
+			continue
+		}
+
+		// The object type indication, stream type, buffer size, max bitrate and
+		// average bitrate precede the decoder specific info
+		if len(decoderConfig) < 13 {
+			return
+		}
+
+		if avgBitrate := binary.BigEndian.Uint32(decoderConfig[9:13]); avgBitrate > 0 {
+			track.Bitrate = int(avgBitrate)
+		}
+
+		// Only MPEG-4 audio (0x40) has an AudioSpecificConfig
+		if decoderConfig[0] != 0x40 {
+			return
+		}
+
+		decoderConfig = decoderConfig[13:]
+		for len(decoderConfig) > 0 {
+			tag, specificInfo, rest, ok := parseDescriptor(decoderConfig)
+			if !ok {
+				return
+			}
+			decoderConfig = rest
+
+			if tag == 0x05 {
+				inspectAudioSpecificConfig(track, specificInfo)
+				return
+			}
+		}
+
+		return
+	}
+}
+
+// inspectAudioSpecificConfig sets the codec info of track from an MPEG-4
+// AudioSpecificConfig.
+//
+// SEE: ISO/IEC 14496-3, 1.6.2.1.
+func inspectAudioSpecificConfig(track *Track, config []byte) {
+	r := &bitReader{b: config}
+
+	objectType, ok := readAudioObjectType(r)
+	if !ok {
+		return
+	}
+
+	sampleRate, ok := readSamplingFrequency(r)
+	if !ok {
+		return
+	}
+
+	channels, ok := r.read(4)
+	if !ok {
+		return
+	}
+
+	// Explicitly signaled HE-AAC specifies the sampling frequency of the SBR
+	// extension, which is the sample rate of the decoded audio
+	if objectType == AudioObjectTypeSBR || objectType == AudioObjectTypePS {
+		if extensionSampleRate, ok := readSamplingFrequency(r); ok {
+			sampleRate = extensionSampleRate
+		}
+	}
+
+	track.ObjectType = objectType
+	if sampleRate > 0 {
+		track.SampleRate = sampleRate
+	}
+	// A channel configuration of zero is specified elsewhere in the stream
+	if channels > 0 {
+		track.Channels = int(channels)
+	}
+}
+
+// readAudioObjectType reads an audio object type, which is escaped if it
+// does not fit in five bits.
+func readAudioObjectType(r *bitReader) (int, bool) {
+	objectType, ok := r.read(5)
+	if !ok {
+		return 0, false
+	}
+
+	if objectType == 31 {
+		extended, ok := r.read(6)
+		if !ok {
+			return 0, false
+		}
+		objectType = 32 + extended
+	}
+
+	return int(objectType), true
+}
+
+// readSamplingFrequency reads a sampling frequency index, or an explicit
+// frequency. Returns zero for reserved indices.
+func readSamplingFrequency(r *bitReader) (int, bool) {
+	index, ok := r.read(4)
+	if !ok {
+		return 0, false
+	}
+
+	if index == 15 {
+		frequency, ok := r.read(24)
+		return int(frequency), ok
+	}
+
+	if int(index) < len(samplingFrequencies) {
+		return samplingFrequencies[index], true
+	}
+
+	return 0, true
+}
+
+// parseDescriptor returns the tag and content of the MPEG-4 descriptor at the
+// start of b, as well as the bytes following it.
+//
+// SEE: ISO/IEC 14496-1, 8.3.3.
+func parseDescriptor(b []byte) (byte, []byte, []byte, bool) {
+	if len(b) < 2 {
+		return 0, nil, nil, false
+	}
+
+	tag := b[0]
+
+	// The size is written in up to four bytes of seven bits each, where the
+	// most significant bit marks that another byte follows
+	var size int
+	i := 1
+	for ; i < len(b) && i <= 4; i++ {
+		size = size<<7 | int(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			break
+		}
+	}
+	if i >= len(b) || i > 4 {
+		return 0, nil, nil, false
+	}
+
+	b = b[i+1:]
+	if size > len(b) {
+		return 0, nil, nil, false
+	}
+
+	return tag, b[:size], b[size:], true
+}
+
+// bitReader reads big-endian bit fields.
+type bitReader struct {
+	b []byte
+	// offset is the offset in bits.
+	offset int
+}
+
+// read reads n bits, at most 32. Returns false if there are not enough bits.
+func (r *bitReader) read(n int) (uint32, bool) {
+	if r.offset+n > len(r.b)*8 {
+		return 0, false
+	}
+
+	var value uint32
+	for range n {
+		bit := r.b[r.offset/8] >> (7 - r.offset%8) & 1
+		value = value<<1 | uint32(bit)
+		r.offset++
+	}
+
+	return value, true
+}
@@ -0,0 +1,125 @@
+package mp4
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	inspection := inspectFile(t, "./empty.m4a")
+
+	assert.Equal(t, time.Second, inspection.Duration)
+	// The mdat box has 65 bytes of media
+	assert.Equal(t, 520, inspection.Bitrate)
+
+	assert.Equal(t, []Track{
+		{
+			ID:         1,
+			Handler:    "soun",
+			Codec:      "mp4a",
+			ObjectType: AudioObjectTypeAACLC,
+			SampleRate: 11025,
+			Channels:   1,
+			Bitrate:    475,
+			// 12049 samples at 11025 Hz, including a frame of encoder delay
+			Duration: 1092879818 * time.Nanosecond,
+		},
+	}, inspection.Tracks)
+
+	types := make([]string, 0)
+	for _, box := range inspection.Boxes {
+		types = append(types, box.Type)
+	}
+	assert.Equal(t, []string{"ftyp", "free", "mdat", "moov"}, types)
+
+	moov := inspection.Boxes[3]
+	assert.Equal(t, int64(109), moov.Offset)
+	assert.Equal(t, int64(810), moov.Size)
+	assert.Equal(t, BoxInfo{Type: "mvhd", Offset: 117, Size: 108}, moov.Children[0])
+
+	require.NotNil(t, inspection.Metadata)
+	require.Len(t, inspection.Metadata.Unknown, 1)
+	assert.Equal(t, "\xa9too", inspection.Metadata.Unknown[0].Type)
+}
+
+func TestInspectJSON(t *testing.T) {
+	inspection := inspectFile(t, "./empty.m4a")
+
+	content, err := json.Marshal(inspection)
+	require.NoError(t, err)
+
+	var decoded struct {
+		Duration float64 `json:"duration"`
+		Tracks   []struct {
+			Codec    string  `json:"codec"`
+			Duration float64 `json:"duration"`
+		} `json:"tracks"`
+	}
+	require.NoError(t, json.Unmarshal(content, &decoded))
+	assert.Equal(t, 1.0, decoded.Duration)
+	require.Len(t, decoded.Tracks, 1)
+	assert.Equal(t, "mp4a", decoded.Tracks[0].Codec)
+	assert.InDelta(t, 1.093, decoded.Tracks[0].Duration, 0.001)
+}
+
+func TestInspectAudioSpecificConfig(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Config   []byte
+		Expected Track
+	}{
+		{
+			Name: "AAC LC",
+			// 2 (AAC LC), 4 (44100 Hz), 2 channels
+			Config:   []byte{0x12, 0x10},
+			Expected: Track{ObjectType: AudioObjectTypeAACLC, SampleRate: 44100, Channels: 2},
+		},
+		{
+			Name: "HE-AAC",
+			// 5 (SBR), 6 (24000 Hz), 2 channels, 3 (48000 Hz), 2 (AAC LC)
+			Config:   []byte{0x2b, 0x11, 0x88, 0x00},
+			Expected: Track{ObjectType: AudioObjectTypeSBR, SampleRate: 48000, Channels: 2},
+		},
+		{
+			Name: "explicit sampling frequency",
+			// 2 (AAC LC), 15 (explicit), 44100 Hz, 1 channel
+			Config:   []byte{0x17, 0x80, 0x56, 0x22, 0x08},
+			Expected: Track{ObjectType: AudioObjectTypeAACLC, SampleRate: 44100, Channels: 1},
+		},
+		{
+			Name:     "truncated",
+			Config:   []byte{0x12},
+			Expected: Track{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			var track Track
+			inspectAudioSpecificConfig(&track, testCase.Config)
+			assert.Equal(t, testCase.Expected, track)
+		})
+	}
+}
+
+// inspectFile inspects the MP4 file at path.
+func inspectFile(t *testing.T, path string) *Inspection {
+	t.Helper()
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	stat, err := file.Stat()
+	require.NoError(t, err)
+
+	inspection, err := Inspect(file, stat.Size())
+	require.NoError(t, err)
+
+	return inspection
+}
@@ -3,10 +3,14 @@ package mp4
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"reflect"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -49,18 +53,127 @@ import (
 //   - Published year
 //   - ...
 type Metadata struct {
-	Title       string    `box:"\xa9nam"`
-	Artist      string    `box:"\xa9ART"`
-	Album       string    `box:"\xa9alb"`
-	Description string    `box:"desc"`
-	Copyright   string    `box:"\xa9cpy"`
-	Released    time.Time `box:"\xa9day"`
+	Title       string `box:"\xa9nam" json:"title,omitempty"`
+	Artist      string `box:"\xa9ART" json:"artist,omitempty"`
+	AlbumArtist string `box:"aART" json:"albumArtist,omitempty"`
+	Album       string `box:"\xa9alb" json:"album,omitempty"`
+	Genre       string `box:"\xa9gen" json:"genre,omitempty"`
+	Comment     string `box:"\xa9cmt" json:"comment,omitempty"`
+	Track       Pair   `box:"trkn" json:"track,omitzero"`
+	Disc        Pair   `box:"disk" json:"disc,omitzero"`
+	Description string `box:"desc" json:"description,omitempty"`
+	// LongDescription is the full description, as Apple's players truncate
+	// Description to 255 characters.
+	LongDescription string    `box:"ldes" json:"longDescription,omitempty"`
+	Copyright       string    `box:"\xa9cpy" json:"copyright,omitempty"`
+	Released        time.Time `box:"\xa9day" json:"released,omitzero"`
+
+	// Podcast marks the file as a podcast episode.
+	Podcast bool `box:"pcst" json:"podcast,omitempty"`
+	// PodcastURL is the URL of the podcast's feed.
+	PodcastURL string `box:"purl,implicit" json:"podcastUrl,omitempty"`
+	// EpisodeGUID uniquely identifies the podcast episode.
+	EpisodeGUID string `box:"egid,implicit" json:"episodeGuid,omitempty"`
+	Category    string `box:"catg" json:"category,omitempty"`
+	// Keywords are comma-separated keywords.
+	Keywords string `box:"keyw" json:"keywords,omitempty"`
+
+	// Show is the name of the TV show, used by some players for podcasts.
+	Show string `box:"tvsh" json:"show,omitempty"`
+	// EpisodeID identifies the episode of the TV show.
+	EpisodeID string `box:"tven" json:"episodeId,omitempty"`
+
+	// Sort fields are used instead of the corresponding fields when sorting.
+
+	SortTitle       string `box:"sonm" json:"sortTitle,omitempty"`
+	SortArtist      string `box:"soar" json:"sortArtist,omitempty"`
+	SortAlbumArtist string `box:"soaa" json:"sortAlbumArtist,omitempty"`
+	SortAlbum       string `box:"soal" json:"sortAlbum,omitempty"`
+	SortShow        string `box:"sosn" json:"sortShow,omitempty"`
+
+	// Freeform contains freeform ("----") items, identified by a reverse DNS
+	// mean and a name, such as "com.apple.iTunes" and "iTunSMPB".
+	Freeform []FreeformItem `json:"freeform,omitempty"`
+
+	// Unknown contains read items that are not represented by other fields,
+	// such as the encoder ("\xa9too"). They are written as is.
+	Unknown []RawItem `json:"unknown,omitempty"`
+}
+
+// Pair is a number out of a total, such as track 1 of 10. A zero total is
+// unknown.
+type Pair struct {
+	Number int `json:"number"`
+	Total  int `json:"total,omitempty"`
+}
+
+// FreeformItem is a freeform ("----") item, holding a UTF-8 value.
+type FreeformItem struct {
+	// Mean is the reverse DNS domain of the item's owner, such as "se.sr".
+	Mean  string `json:"mean"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// FreeformValue returns the value of the freeform item identified by mean and
+// name, or an empty string if there is no such item.
+func (m *Metadata) FreeformValue(mean string, name string) string {
+	for _, item := range m.Freeform {
+		if item.Mean == mean && item.Name == name {
+			return item.Value
+		}
+	}
+
+	return ""
+}
+
+// SetFreeform sets the value of the freeform item identified by mean and
+// name, adding the item if it doesn't exist. An empty value removes the item.
+func (m *Metadata) SetFreeform(mean string, name string, value string) {
+	for i, item := range m.Freeform {
+		if item.Mean == mean && item.Name == name {
+			if value == "" {
+				m.Freeform = slices.Delete(m.Freeform, i, i+1)
+			} else {
+				m.Freeform[i].Value = value
+			}
+			return
+		}
+	}
+
+	if value != "" {
+		m.Freeform = append(m.Freeform, FreeformItem{Mean: mean, Name: name, Value: value})
+	}
+}
+
+// parseBoxTag returns the box type of a field's box tag and whether or not
+// the value is written using the implicit data type rather than as UTF-8.
+func parseBoxTag(tag string) (string, bool) {
+	box, options, _ := strings.Cut(tag, ",")
+	return box, options == "implicit"
 }
 
 // Bytes returns the MP4 byte representation of the metadata, to be put into a
 // ilst box.
-func (m Metadata) Bytes() []byte {
+func (m Metadata) Bytes() ([]byte, error) {
+	items, err := m.items()
+	if err != nil {
+		return nil, err
+	}
+
 	var buffer bytes.Buffer
+	for _, item := range items {
+		if _, err := item.WriteTo(&buffer); err != nil {
+			return nil, err
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// items returns the boxes of the ilst box representing the metadata.
+func (m Metadata) items() ([]*Box, error) {
+	items := make([]*Box, 0)
 
 	structValue := reflect.ValueOf(m)
 	structType := structValue.Type()
@@ -81,148 +194,288 @@ func (m Metadata) Bytes() []byte {
 			continue
 		}
 
-		formattedValue := ""
+		box, implicit := parseBoxTag(box)
+
+		// NOTE: the data box starts with "the_type" | "the_locale", where the
+		// locale is always the default.
+		// SEE: https://developer.apple.com/documentation/quicktime-file-format/metadata_item_list_atom
+		var dataType uint32 = dataTypeUTF8
+		var value []byte
 		switch v := fieldValue.Interface().(type) {
 		case string:
-			formattedValue = v
+			value = []byte(v)
+			if implicit {
+				dataType = dataTypeImplicit
+			}
 		case time.Time:
-			formattedValue = v.Format(time.RFC3339)
+			value = []byte(v.Format(time.RFC3339))
+		case bool:
+			dataType = dataTypeSignedInt
+			value = []byte{1}
+		case Pair:
+			// Both trkn and disk are two reserved bytes followed by the number and
+			// total as 16-bit integers. Track numbers have two trailing reserved
+			// bytes
+			if v.Number < 0 || v.Number > math.MaxUint16 || v.Total < 0 || v.Total > math.MaxUint16 {
+				return nil, fmt.Errorf("invalid %s %d/%d", fieldType.Name, v.Number, v.Total)
+			}
+			dataType = dataTypeImplicit
+			value = make([]byte, 2, 8)
+			value = binary.BigEndian.AppendUint16(value, uint16(v.Number))
+			value = binary.BigEndian.AppendUint16(value, uint16(v.Total))
+			if box == "trkn" {
+				value = append(value, 0x00, 0x00)
+			}
 		default:
-			panic(fmt.Errorf("invalid metadata field of type %s", fieldType.Type.String()))
+			return nil, fmt.Errorf("invalid metadata field of type %s", fieldType.Type.String())
 		}
 
-		// Write the box header, the box will contain a data box
-		if err := writeBoxHeader(&buffer, uint32(8+8+8+len(formattedValue)), box); err != nil {
-			panic(err)
-		}
+		data := binary.BigEndian.AppendUint32(nil, dataType)
+		data = append(data, 0x00, 0x00, 0x00, 0x00)
+		data = append(data, value...)
 
-		// Write the data header, the box will contain the value of the field
-		if err := writeBoxHeader(&buffer, uint32(8+8+len(formattedValue)), "data"); err != nil {
-			panic(err)
+		content, err := NewBox("data", data).Bytes()
+		if err != nil {
+			return nil, err
 		}
 
-		// NOTE: the bytes being written are "the_type" | "the_locale".
-		// FFMPEG never seems to set these to anything else than the following
-		// bytes.
-		// SEE: https://developer.apple.com/documentation/quicktime-file-format/metadata_item_list_atom
-		if _, err := buffer.Write([]byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}); err != nil {
-			panic(err)
-		}
+		items = append(items, NewBox(box, content))
+	}
 
-		// Write the actual value
-		if _, err := buffer.WriteString(formattedValue); err != nil {
-			panic(err)
+	for _, item := range m.Freeform {
+		// The mean and name boxes are full boxes with a version and flags, the
+		// data box is like the data box of other items
+		var content bytes.Buffer
+		for _, box := range []*Box{
+			NewBox("mean", append([]byte{0x00, 0x00, 0x00, 0x00}, item.Mean...)),
+			NewBox("name", append([]byte{0x00, 0x00, 0x00, 0x00}, item.Name...)),
+			NewBox("data", append([]byte{0x00, 0x00, 0x00, dataTypeUTF8, 0x00, 0x00, 0x00, 0x00}, item.Value...)),
+		} {
+			if _, err := box.WriteTo(&content); err != nil {
+				return nil, err
+			}
 		}
+
+		items = append(items, NewBox("----", content.Bytes()))
 	}
 
-	return buffer.Bytes()
+	for _, item := range m.Unknown {
+		items = append(items, NewBox(item.Type, item.Data))
+	}
+
+	return items, nil
+}
+
+// DefaultPadding is the default size of the free space reserved after the
+// metadata when a file is rewritten, allowing later changes to the metadata
+// to be written in place.
+const DefaultPadding = 1024
+
+// ErrInsufficientSpace is returned when writing metadata in place, but the
+// metadata doesn't fit in the existing free space.
+var ErrInsufficientSpace = errors.New("insufficient free space for metadata")
+
+// WriteOptions configures how metadata is written.
+type WriteOptions struct {
+	// Padding is the number of bytes of free space to reserve after the
+	// metadata when the file is rewritten. Existing free space is always used if the metadata
+	// fits, in which case the file is not rewritten.
+	Padding int
+	// InPlace requires the metadata to fit in the existing free space. If it
+	// doesn't, [ErrInsufficientSpace] is returned and the file is left as is.
+	// Unlike rewriting a file, writing in place only overwrites moov and never
+	// moves the media data.
+	InPlace bool
 }
 
+// Write writes the metadata to the MP4 file f, replacing any existing
+// metadata. The udta, meta and ilst boxes are created if they don't exist.
+// [DefaultPadding] bytes of free space are reserved if the file is rewritten.
 func (m Metadata) Write(f *os.File) error {
-	stat, err := f.Stat()
-	if err != nil {
-		return err
+	return m.WriteWithOptions(f, nil)
+}
+
+// WriteWithOptions writes the metadata like [Metadata.Write], configured by
+// options. Nil options results in the defaults.
+func (m Metadata) WriteWithOptions(f *os.File, options *WriteOptions) error {
+	padding := DefaultPadding
+	inPlace := false
+	if options != nil {
+		padding = options.Padding
+		inPlace = options.InPlace
 	}
 
-	moovOffset, moovSize, err := seekBox(f, "moov")
-	if err != nil {
-		return err
+	if padding < 0 {
+		return fmt.Errorf("invalid padding %d", padding)
 	}
 
-	udtaOffset, udtaSize, err := seekBox(f, "udta")
+	stat, err := f.Stat()
 	if err != nil {
 		return err
 	}
 
-	metaOffset, metaSize, err := seekBox(f, "meta")
+	file, err := Parse(f, stat.Size())
 	if err != nil {
 		return err
 	}
 
-	// The meta box has a larger header, skip it
-	f.Seek(4, io.SeekCurrent)
+	moovIndex := file.Index("moov")
+	if moovIndex == -1 {
+		return fmt.Errorf("no moov box found")
+	}
 
-	ilstOffset, ilstSize, err := seekBox(f, "ilst")
+	moov := file.Boxes[moovIndex]
+	moovEnd := stat.Size()
+	if moovIndex+1 < len(file.Boxes) {
+		moovEnd = file.Boxes[moovIndex+1].Offset
+	}
+	moovSize := moovEnd - moov.Offset
+
+	// Free space directly after moov may be used by moov
+	availableEnd := moovEnd
+	for i := moovIndex + 1; i < len(file.Boxes) && isFreeSpace(file.Boxes[i]); i++ {
+		availableEnd = stat.Size()
+		if i+1 < len(file.Boxes) {
+			availableEnd = file.Boxes[i+1].Offset
+		}
+	}
+	available := availableEnd - moov.Offset
+
+	items, err := m.items()
 	if err != nil {
 		return err
 	}
 
-	mb := m.Bytes()
+	ilst := metadataItemList(moov)
+	ilst.Children = items
+
+	// Replace any free space in meta with a single box after ilst
+	meta := moov.Find("udta", "meta")
+	meta.Children = slices.DeleteFunc(meta.Children, isFreeSpace)
+	free := NewBox("free", nil)
+	meta.Children = slices.Insert(meta.Children, slices.Index(meta.Children, ilst)+1, free)
+
+	// Write moov in place if it fits in the available space, filling the rest
+	// with free space. The position of the media data is unchanged
+	if required := moov.Size(); required <= available || required-free.Size() == available {
+		if required > available {
+			meta.Children = slices.DeleteFunc(meta.Children, func(box *Box) bool { return box == free })
+		} else {
+			free.Data = make([]byte, available-required)
+		}
 
-	dsize := len(mb) + 8 - int(ilstSize)
+		content, err := moov.Bytes()
+		if err != nil {
+			return err
+		}
 
-	if _, err := f.WriteAt(formatBoxHeader(uint32(int(moovSize)+dsize), "moov"), moovOffset); err != nil {
+		_, err = f.WriteAt(content, moov.Offset)
 		return err
 	}
 
-	if _, err := f.WriteAt(formatBoxHeader(uint32(int(udtaSize)+dsize), "udta"), moovOffset+8+udtaOffset); err != nil {
-		return err
+	if inPlace {
+		return ErrInsufficientSpace
 	}
 
-	if _, err := f.WriteAt(formatBoxHeader(uint32(int(metaSize)+dsize), "meta"), moovOffset+8+udtaOffset+8+metaOffset); err != nil {
-		return err
+	if padding > 0 {
+		free.Data = make([]byte, padding)
+	} else {
+		meta.Children = slices.DeleteFunc(meta.Children, func(box *Box) bool { return box == free })
 	}
 
-	if _, err := f.WriteAt(formatBoxHeader(uint32(int(ilstSize)+dsize), "ilst"), moovOffset+8+udtaOffset+8+metaOffset+12+ilstOffset); err != nil {
+	// When moov precedes mdat, such as in files optimized for streaming, the
+	// media data moves as moov changes in size
+	if err := shiftChunkOffsets(moov, moovSize, moovEnd); err != nil {
 		return err
 	}
 
-	if dsize > 0 {
-		if err := f.Truncate(stat.Size() + int64(dsize)); err != nil {
-			return err
-		}
+	return rewrite(f, file, moovIndex)
+}
+
+// isFreeSpace returns whether or not box is unused space.
+func isFreeSpace(box *Box) bool {
+	return box.Type == "free" || box.Type == "skip"
+}
+
+// metadataItemList returns the ilst box of moov, creating it and its parents
+// if necessary.
+func metadataItemList(moov *Box) *Box {
+	udta := moov.Find("udta")
+	if udta == nil {
+		udta = NewContainer("udta")
+		moov.Children = append(moov.Children, udta)
 	}
 
-	if _, err := f.WriteAt(mb, moovOffset+8+udtaOffset+8+metaOffset+12+ilstOffset+8); err != nil {
-		return err
+	meta := udta.Find("meta")
+	if meta == nil {
+		// The handler identifies the metadata as iTunes-style metadata
+		// SEE: https://developer.apple.com/documentation/quicktime-file-format/metadata_handler_atom
+		hdlr := NewBox("hdlr", []byte{
+			// Pre-defined
+			0x00, 0x00, 0x00, 0x00,
+			// Handler type
+			'm', 'd', 'i', 'r',
+			// Reserved, where the first value is the manufacturer by convention
+			'a', 'p', 'p', 'l',
+			0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00,
+			// Empty, null-terminated name
+			0x00,
+		})
+		meta = NewContainer("meta", hdlr)
+		udta.Children = append(udta.Children, meta)
 	}
 
-	// Assumes the ilst box is the last box as nothing will be written after it
+	ilst := meta.Find("ilst")
+	if ilst == nil {
+		ilst = NewContainer("ilst")
+		meta.Children = append(meta.Children, ilst)
+	}
 
-	return nil
+	return ilst
 }
 
-func seekBox(r io.ReadSeeker, needle string) (int64, uint32, error) {
-	var boxOffset uint32 = 0
-	for {
-		boxSize, boxType, err := readBoxHeader(r)
-		if err == io.EOF {
-			return -1, 0, nil
-		} else if err != nil {
-			return -1, 0, err
+// rewrite writes the top-level boxes of file from the index to f, starting at
+// the offset of the box at the index, and truncates f. The boxes before the
+// index are expected to be unchanged.
+func rewrite(f *os.File, file *File, index int) error {
+	offset := file.Boxes[index].Offset
+	tail := &File{Boxes: file.Boxes[index:]}
+
+	// The content of large boxes, such as mdat, is read from f when written, so
+	// boxes that follow the changed box must be written elsewhere first, to not
+	// be overwritten before they are read
+	var content io.Reader
+	var size int64
+	if index == len(file.Boxes)-1 {
+		var buffer bytes.Buffer
+		if _, err := tail.WriteTo(&buffer); err != nil {
+			return err
 		}
-
-		if boxType == needle {
-			return int64(boxOffset), boxSize, nil
+		content = &buffer
+		size = int64(buffer.Len())
+	} else {
+		temp, err := os.CreateTemp("", "srdl-mp4-*")
+		if err != nil {
+			return err
 		}
+		defer os.Remove(temp.Name())
+		defer temp.Close()
 
-		// Seek past the box's data
-		if _, err := r.Seek(int64(boxSize)-8, io.SeekCurrent); err != nil {
-			return -1, 0, err
+		size, err = tail.WriteTo(temp)
+		if err != nil {
+			return err
 		}
 
-		boxOffset += boxSize
+		if _, err := temp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		content = temp
 	}
-}
 
-func readBoxHeader(r io.Reader) (uint32, string, error) {
-	var buffer [8]byte
-	if _, err := r.Read(buffer[:]); err != nil {
-		return 0, "", err
+	if _, err := io.Copy(io.NewOffsetWriter(f, offset), content); err != nil {
+		return err
 	}
 
-	return binary.BigEndian.Uint32(buffer[0:4]), string(buffer[4:8]), nil
-}
-
-func formatBoxHeader(boxSize uint32, boxType string) []byte {
-	var buffer [8]byte
-	binary.BigEndian.PutUint32(buffer[0:], boxSize)
-	copy(buffer[4:], []byte(boxType))
-	return buffer[:]
-}
-
-func writeBoxHeader(w io.Writer, boxSize uint32, boxType string) error {
-	buffer := formatBoxHeader(boxSize, boxType)
-	_, err := w.Write(buffer[:])
-	return err
+	return f.Truncate(offset + size)
 }
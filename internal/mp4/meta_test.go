@@ -4,9 +4,8 @@ import (
 	"bytes"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,31 +32,225 @@ func TestMetadataWrite(t *testing.T) {
 
 	require.NoError(t, metadata.Write(file))
 
-	var output bytes.Buffer
-
-	ffprobe := exec.Command("ffprobe", target)
-	ffprobe.Stderr = &output
-	ffprobe.Stdout = &output
-	require.NoError(t, ffprobe.Run())
-
-	metadataRegexp := regexp.MustCompile(`(?m)  Metadata:\n(    \w+ *: *[^\n]+\n)*`)
-	whitespaceRegexp := regexp.MustCompile(`(?m)^ +| +$`)
-	createdMetadata := metadataRegexp.FindString(output.String())
-	createdMetadata = whitespaceRegexp.ReplaceAllString(createdMetadata, "")
-
-	expectedMetadata := `Metadata:
-major_brand     : M4A
-minor_version   : 512
-compatible_brands: M4A isomiso2
-title           : A very long title for testing
-artist          : Some artist
-album           : Album
-description     : Some description
-copyright       : 2024
-date            : 2024-11-09T12:29:56Z
-`
-
-	assert.Equal(t, expectedMetadata, createdMetadata)
+	original := inspectFile(t, "./empty.m4a")
+	written := inspectFile(t, target)
+
+	assert.Equal(t, &metadata, written.Metadata)
+
+	// The audio must be left as is
+	assert.Equal(t, original.Tracks, written.Tracks)
+	assert.Equal(t, original.Duration, written.Duration)
+	assert.Equal(t, original.Boxes[0], written.Boxes[0])
+}
+
+func TestMetadataBytes(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Metadata Metadata
+		Expected string
+	}{
+		{
+			Name:     "text",
+			Metadata: Metadata{Genre: "Musik"},
+			Expected: "\x00\x00\x00\x1d\xa9gen\x00\x00\x00\x15data\x00\x00\x00\x01\x00\x00\x00\x00Musik",
+		},
+		{
+			Name:     "implicit text",
+			Metadata: Metadata{EpisodeGUID: "1"},
+			Expected: "\x00\x00\x00\x19egid\x00\x00\x00\x11data\x00\x00\x00\x00\x00\x00\x00\x001",
+		},
+		{
+			Name:     "boolean",
+			Metadata: Metadata{Podcast: true},
+			Expected: "\x00\x00\x00\x19pcst\x00\x00\x00\x11data\x00\x00\x00\x15\x00\x00\x00\x00\x01",
+		},
+		{
+			Name:     "track",
+			Metadata: Metadata{Track: Pair{Number: 3, Total: 10}},
+			Expected: "\x00\x00\x00\x20trkn\x00\x00\x00\x18data\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x03\x00\x0a\x00\x00",
+		},
+		{
+			Name:     "disc",
+			Metadata: Metadata{Disc: Pair{Number: 1, Total: 2}},
+			Expected: "\x00\x00\x00\x1edisk\x00\x00\x00\x16data\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x02",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			actual, err := testCase.Metadata.Bytes()
+			require.NoError(t, err)
+			assert.Equal(t, []byte(testCase.Expected), actual)
+		})
+	}
+}
+
+func TestMetadataBytesInvalid(t *testing.T) {
+	_, err := Metadata{Track: Pair{Number: 1 << 16}}.Bytes()
+	assert.Error(t, err)
+
+	_, err = Metadata{Disc: Pair{Number: 1, Total: -1}}.Bytes()
+	assert.Error(t, err)
+}
+
+func TestMetadataSetFreeform(t *testing.T) {
+	var metadata Metadata
+	metadata.SetFreeform("se.sr", "episode_id", "1")
+	metadata.SetFreeform("se.sr", "program_id", "2")
+	metadata.SetFreeform("se.sr", "episode_id", "3")
+	assert.Equal(t, []FreeformItem{
+		{Mean: "se.sr", Name: "episode_id", Value: "3"},
+		{Mean: "se.sr", Name: "program_id", Value: "2"},
+	}, metadata.Freeform)
+	assert.Equal(t, "3", metadata.FreeformValue("se.sr", "episode_id"))
+	assert.Equal(t, "", metadata.FreeformValue("com.apple.iTunes", "episode_id"))
+
+	metadata.SetFreeform("se.sr", "episode_id", "")
+	assert.Equal(t, []FreeformItem{{Mean: "se.sr", Name: "program_id", Value: "2"}}, metadata.Freeform)
+}
+
+func TestMetadataWritePadding(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Create func(t *testing.T) []byte
+	}{
+		{
+			Name: "moov after mdat",
+			Create: func(t *testing.T) []byte {
+				content, err := os.ReadFile("./empty.m4a")
+				require.NoError(t, err)
+				return content
+			},
+		},
+		{
+			Name:   "moov before mdat",
+			Create: createFastStartFile,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			content := testCase.Create(t)
+			expectedChunks := readChunks(t, content)
+
+			target := filepath.Join(t.TempDir(), "file.m4a")
+			require.NoError(t, os.WriteFile(target, content, 0644))
+
+			file, err := os.OpenFile(target, os.O_RDWR, 0)
+			require.NoError(t, err)
+			defer file.Close()
+
+			// The file is rewritten with padding
+			require.NoError(t, Metadata{Title: "Title"}.WriteWithOptions(file, &WriteOptions{Padding: 100}))
+			stat, err := file.Stat()
+			require.NoError(t, err)
+			size := stat.Size()
+
+			free := parseFile(t, target).Find("moov", "udta", "meta", "free")
+			require.NotNil(t, free)
+			assert.Len(t, free.Data, 100)
+
+			// Metadata that fits in the padding is written in place
+			metadata := Metadata{Title: "A longer title", Album: "Album"}
+			require.NoError(t, metadata.WriteWithOptions(file, &WriteOptions{Padding: 100}))
+			stat, err = file.Stat()
+			require.NoError(t, err)
+			assert.Equal(t, size, stat.Size())
+
+			written, err := os.ReadFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, expectedChunks, readChunks(t, written))
+
+			actual, err := readMetadataFromFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, &metadata, actual)
+
+			// Metadata that doesn't fit is not written when required to be in place
+			before, err := os.ReadFile(target)
+			require.NoError(t, err)
+			metadata = Metadata{Description: strings.Repeat("a", 200)}
+			assert.ErrorIs(t, metadata.WriteWithOptions(file, &WriteOptions{Padding: 100, InPlace: true}), ErrInsufficientSpace)
+			after, err := os.ReadFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, before, after)
+
+			// Metadata that doesn't fit causes the file to be rewritten
+			require.NoError(t, metadata.WriteWithOptions(file, &WriteOptions{Padding: 100}))
+			stat, err = file.Stat()
+			require.NoError(t, err)
+			assert.Greater(t, stat.Size(), size)
+
+			written, err = os.ReadFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, expectedChunks, readChunks(t, written))
+
+			actual, err = readMetadataFromFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, &metadata, actual)
+		})
+	}
+}
+
+func TestMetadataWriteUsesFreeSpaceAfterMoov(t *testing.T) {
+	// Move the top-level free box to directly after moov
+	content := createFastStartFile(t)
+	file, err := Parse(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	require.Equal(t, []string{"ftyp", "free", "moov", "mdat"}, boxTypes(file.Boxes))
+	file.Boxes[1], file.Boxes[2] = file.Boxes[2], file.Boxes[1]
+	file.Boxes[2].Data = make([]byte, 100)
+
+	// Growing the free box moves the chunks
+	tables, err := chunkOffsetTables(file.Boxes[1])
+	require.NoError(t, err)
+	for _, table := range tables {
+		_, err := table.shift(0, 100)
+		require.NoError(t, err)
+	}
+
+	var buffer bytes.Buffer
+	_, err = file.WriteTo(&buffer)
+	require.NoError(t, err)
+	content = buffer.Bytes()
+	expectedChunks := readChunks(t, content)
+
+	target := filepath.Join(t.TempDir(), "file.m4a")
+	require.NoError(t, os.WriteFile(target, content, 0644))
+
+	f, err := os.OpenFile(target, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	metadata := Metadata{Title: "A very long title for testing"}
+	require.NoError(t, metadata.WriteWithOptions(f, &WriteOptions{Padding: 0}))
+
+	// The free box is absorbed by moov
+	written, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Len(t, written, len(content))
+	assert.Equal(t, expectedChunks, readChunks(t, written))
+	assert.Equal(t, []string{"ftyp", "moov", "mdat"}, boxTypes(parseFile(t, target).Boxes))
+
+	actual, err := readMetadataFromFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, &metadata, actual)
+}
+
+func parseFile(t *testing.T, path string) *File {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	file, err := Parse(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	return file
+}
+
+func boxTypes(boxes []*Box) []string {
+	types := make([]string, 0, len(boxes))
+	for _, box := range boxes {
+		types = append(types, box.Type)
+	}
+	return types
 }
 
 func copyFile(from string, to string) error {
@@ -0,0 +1,376 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Well-known data types of values in metadata items.
+// SEE: https://developer.apple.com/documentation/quicktime-file-format/well-known_types
+const (
+	dataTypeImplicit    = 0
+	dataTypeUTF8        = 1
+	dataTypeUTF16       = 2
+	dataTypeSignedInt   = 21
+	dataTypeUnsignedInt = 22
+)
+
+// releasedLayouts are the layouts of release dates written by common taggers,
+// in order of preference.
+var releasedLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006",
+}
+
+// RawItem is a metadata item that is not represented by a field of
+// [Metadata]. It is written back as is.
+type RawItem struct {
+	// Type is the item's box type, such as "\xa9too".
+	Type string
+	// Data is the item's content, excluding its box header.
+	Data []byte
+}
+
+// MarshalJSON implements [json.Marshaler]. The type is encoded as Latin-1,
+// such that "\xa9too" is encoded as "©too".
+func (i RawItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Data []byte `json:"data"`
+	}{
+		Type: boxTypeString(i.Type),
+		Data: i.Data,
+	})
+}
+
+// boxTypeString returns the box type decoded as Latin-1, which is how types
+// such as "\xa9nam" are conventionally displayed.
+func boxTypeString(boxType string) string {
+	var builder strings.Builder
+	for i := 0; i < len(boxType); i++ {
+		builder.WriteRune(rune(boxType[i]))
+	}
+	return builder.String()
+}
+
+// ReadMetadata reads the metadata of the MP4 file r of the specified size. A
+// file without metadata results in empty metadata.
+func ReadMetadata(r io.ReaderAt, size int64) (*Metadata, error) {
+	file, err := Parse(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return readMetadata(file)
+}
+
+// readMetadata reads the metadata of the parsed file.
+func readMetadata(file *File) (*Metadata, error) {
+	ilst := file.Find("moov", "udta", "meta", "ilst")
+	if ilst == nil {
+		return &Metadata{}, nil
+	}
+
+	// Items are leaves, so serializing the box is cheap
+	content, err := ilst.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseMetadata(content[8:])
+}
+
+// ReadDuration reads the duration of the MP4 file r of the specified size, as
+// specified by its movie header (mvhd) box.
+func ReadDuration(r io.ReaderAt, size int64) (time.Duration, error) {
+	file, err := Parse(r, size)
+	if err != nil {
+		return 0, err
+	}
+
+	mvhd := file.Find("moov", "mvhd")
+	if mvhd == nil {
+		return 0, fmt.Errorf("missing mvhd box")
+	}
+
+	return parseDuration(mvhd)
+}
+
+// parseDuration returns the duration specified by a movie (mvhd) or media
+// (mdhd) header box, which share the same layout of times.
+func parseDuration(header *Box) (time.Duration, error) {
+	boxType := boxTypeString(header.Type)
+
+	var timescale, duration uint64
+	switch header.Version {
+	case 0:
+		// Creation and modification time, timescale and duration
+		if len(header.Data) < 16 {
+			return 0, fmt.Errorf("truncated %s box", boxType)
+		}
+		timescale = uint64(binary.BigEndian.Uint32(header.Data[8:12]))
+		duration = uint64(binary.BigEndian.Uint32(header.Data[12:16]))
+	case 1:
+		// Same as version 0, but with 64-bit times and duration
+		if len(header.Data) < 28 {
+			return 0, fmt.Errorf("truncated %s box", boxType)
+		}
+		timescale = uint64(binary.BigEndian.Uint32(header.Data[16:20]))
+		duration = binary.BigEndian.Uint64(header.Data[20:28])
+	default:
+		return 0, fmt.Errorf("unsupported %s version %d", boxType, header.Version)
+	}
+
+	if timescale == 0 {
+		return 0, fmt.Errorf("invalid %s timescale", boxType)
+	}
+
+	seconds := duration / timescale
+	if seconds > uint64(math.MaxInt64/time.Second) {
+		return 0, fmt.Errorf("invalid %s duration", boxType)
+	}
+
+	fraction := time.Duration(duration%timescale) * time.Second / time.Duration(timescale)
+	return time.Duration(seconds)*time.Second + fraction, nil
+}
+
+// ParseMetadata parses the content of an ilst box. Items that are not
+// represented by a field of [Metadata], or whose values cannot be decoded,
+// are kept in [Metadata.Unknown].
+func ParseMetadata(ilst []byte) (*Metadata, error) {
+	var metadata Metadata
+
+	fields := make(map[string]int)
+	structType := reflect.TypeOf(metadata)
+	for i := 0; i < structType.NumField(); i++ {
+		if tag := structType.Field(i).Tag.Get("box"); tag != "" {
+			box, _ := parseBoxTag(tag)
+			fields[box] = i
+		}
+	}
+
+	structValue := reflect.ValueOf(&metadata).Elem()
+	for len(ilst) > 0 {
+		boxSize, boxType, err := parseBoxHeader(ilst)
+		if err != nil {
+			return nil, err
+		}
+
+		content := ilst[8:boxSize]
+		ilst = ilst[boxSize:]
+
+		if boxType == "----" {
+			if item, ok := parseFreeform(content); ok {
+				metadata.Freeform = append(metadata.Freeform, item)
+				continue
+			}
+		}
+
+		i, ok := fields[boxType]
+		if !ok || !setField(structValue.Field(i), content) {
+			metadata.Unknown = append(metadata.Unknown, RawItem{
+				Type: boxType,
+				Data: append([]byte(nil), content...),
+			})
+		}
+	}
+
+	return &metadata, nil
+}
+
+// setField sets field to the value of the item's data box. Returns false if
+// the value cannot be represented by the field.
+func setField(field reflect.Value, item []byte) bool {
+	dataType, value, ok := parseData(item)
+	if !ok {
+		return false
+	}
+
+	switch field.Interface().(type) {
+	case bool:
+		integer, ok := decodeInteger(dataType, value)
+		if !ok {
+			return false
+		}
+		field.SetBool(integer != 0)
+		return true
+	case Pair:
+		if dataType != dataTypeImplicit || len(value) < 6 {
+			return false
+		}
+		field.Set(reflect.ValueOf(Pair{
+			Number: int(binary.BigEndian.Uint16(value[2:4])),
+			Total:  int(binary.BigEndian.Uint16(value[4:6])),
+		}))
+		return true
+	}
+
+	var text string
+	switch dataType {
+	case dataTypeUTF8, dataTypeImplicit:
+		text = string(value)
+	case dataTypeUTF16:
+		if len(value)%2 != 0 {
+			return false
+		}
+		units := make([]uint16, len(value)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(value[i*2:])
+		}
+		text = string(utf16.Decode(units))
+	case dataTypeSignedInt, dataTypeUnsignedInt:
+		integer, ok := decodeInteger(dataType, value)
+		if !ok {
+			return false
+		}
+		if dataType == dataTypeSignedInt {
+			text = strconv.FormatInt(integer, 10)
+		} else {
+			text = strconv.FormatUint(uint64(integer), 10)
+		}
+	default:
+		return false
+	}
+
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(text)
+	case time.Time:
+		for _, layout := range releasedLayouts {
+			if released, err := time.Parse(layout, text); err == nil {
+				field.Set(reflect.ValueOf(released))
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+
+	return true
+}
+
+// decodeInteger decodes a big-endian integer of 1 to 8 bytes. Signed integers
+// are sign extended. Implicitly typed values are treated as unsigned, as
+// written by some taggers for flags such as pcst.
+func decodeInteger(dataType uint32, value []byte) (int64, bool) {
+	if dataType != dataTypeSignedInt && dataType != dataTypeUnsignedInt && dataType != dataTypeImplicit {
+		return 0, false
+	}
+
+	if len(value) == 0 || len(value) > 8 {
+		return 0, false
+	}
+
+	var integer uint64
+	for _, b := range value {
+		integer = integer<<8 | uint64(b)
+	}
+
+	if dataType == dataTypeSignedInt {
+		shift := 64 - 8*len(value)
+		return int64(integer<<shift) >> shift, true
+	}
+
+	return int64(integer), true
+}
+
+// parseFreeform parses the content of a freeform ("----") item. Returns false
+// if the item is invalid or if its value is not text.
+func parseFreeform(item []byte) (FreeformItem, bool) {
+	var freeform FreeformItem
+	var hasValue bool
+	for len(item) > 0 {
+		boxSize, boxType, err := parseBoxHeader(item)
+		if err != nil {
+			return FreeformItem{}, false
+		}
+
+		content := item[8:boxSize]
+		item = item[boxSize:]
+
+		switch boxType {
+		case "mean", "name":
+			// Skip the version and flags
+			if len(content) < 4 {
+				return FreeformItem{}, false
+			}
+
+			if boxType == "mean" {
+				freeform.Mean = string(content[4:])
+			} else {
+				freeform.Name = string(content[4:])
+			}
+		case "data":
+			if hasValue || len(content) < 8 {
+				return FreeformItem{}, false
+			}
+
+			dataType := binary.BigEndian.Uint32(content[0:4]) & 0x00ffffff
+			if dataType != dataTypeUTF8 {
+				return FreeformItem{}, false
+			}
+
+			freeform.Value = string(content[8:])
+			hasValue = true
+		}
+	}
+
+	if freeform.Mean == "" || freeform.Name == "" || !hasValue {
+		return FreeformItem{}, false
+	}
+
+	return freeform, true
+}
+
+// parseData returns the type and value of the first data box in item.
+func parseData(item []byte) (uint32, []byte, bool) {
+	for len(item) > 0 {
+		boxSize, boxType, err := parseBoxHeader(item)
+		if err != nil {
+			return 0, nil, false
+		}
+
+		if boxType == "data" {
+			// The type indicator and locale precede the value
+			if boxSize < 16 {
+				return 0, nil, false
+			}
+
+			// The first byte of the type indicator is reserved for the "type set"
+			dataType := binary.BigEndian.Uint32(item[8:12]) & 0x00ffffff
+			return dataType, item[16:boxSize], true
+		}
+
+		item = item[boxSize:]
+	}
+
+	return 0, nil, false
+}
+
+// parseBoxHeader returns the size and type of the box at the start of b. The
+// size is guaranteed to be within b.
+func parseBoxHeader(b []byte) (uint32, string, error) {
+	if len(b) < 8 {
+		return 0, "", fmt.Errorf("truncated box header")
+	}
+
+	boxSize := binary.BigEndian.Uint32(b[0:4])
+	boxType := string(b[4:8])
+	if boxSize < 8 || uint64(boxSize) > uint64(len(b)) {
+		return 0, "", fmt.Errorf("invalid size %d of box %q", boxSize, boxTypeString(boxType))
+	}
+
+	return boxSize, boxType, nil
+}
@@ -0,0 +1,248 @@
+package mp4
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMetadata(t *testing.T) {
+	metadata, err := readMetadataFromFile("./empty.m4a")
+	require.NoError(t, err)
+
+	expected := &Metadata{
+		Unknown: []RawItem{
+			{
+				Type: "\xa9too",
+				Data: append([]byte("\x00\x00\x00\x1cdata\x00\x00\x00\x01\x00\x00\x00\x00"), "Lavf61.7.100"...),
+			},
+		},
+	}
+	assert.Equal(t, expected, metadata)
+
+	encoded, err := json.Marshal(metadata)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"unknown":[{"type":"©too","data":"AAAAHGRhdGEAAAABAAAAAExhdmY2MS43LjEwMA=="}]}`, string(encoded))
+}
+
+func TestReadMetadataWritten(t *testing.T) {
+	metadata := Metadata{
+		Title:       "A very long title for testing",
+		Artist:      "Some artist",
+		Album:       "Album",
+		Description: "Some description",
+		Copyright:   "2024",
+		Released:    time.Date(2024, 11, 9, 12, 29, 56, 0, time.UTC),
+
+		AlbumArtist:     "P2",
+		Genre:           "Musik",
+		Comment:         "Comment",
+		Track:           Pair{Number: 3, Total: 10},
+		Disc:            Pair{Number: 1},
+		LongDescription: "Some long description",
+		Podcast:         true,
+		PodcastURL:      "https://api.sr.se/api/rss/program/4914",
+		EpisodeGUID:     "2522448",
+		Category:        "Musik",
+		Keywords:        "P2,Musik",
+		Show:            "Text och musik med Eric Schüldt",
+		EpisodeID:       "2522448",
+		SortTitle:       "2024-11-09 A very long title",
+		SortArtist:      "artist",
+		SortAlbumArtist: "P2",
+		SortAlbum:       "album",
+		SortShow:        "text och musik",
+
+		Freeform: []FreeformItem{
+			{Mean: "se.sr", Name: "episode_id", Value: "2522448"},
+			{Mean: "com.apple.iTunes", Name: "iTunSMPB", Value: " 00000000 00000840"},
+		},
+
+		Unknown: []RawItem{
+			{
+				Type: "\xa9too",
+				Data: append([]byte("\x00\x00\x00\x1cdata\x00\x00\x00\x01\x00\x00\x00\x00"), "Lavf61.7.100"...),
+			},
+		},
+	}
+
+	target := filepath.Join(t.TempDir(), "with-metadata.m4a")
+	require.NoError(t, copyFile("./empty.m4a", target))
+
+	file, err := os.OpenFile(target, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer file.Close()
+
+	require.NoError(t, metadata.Write(file))
+
+	actual, err := readMetadataFromFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, &metadata, actual)
+}
+
+func TestReadDuration(t *testing.T) {
+	file, err := os.Open("./empty.m4a")
+	require.NoError(t, err)
+	defer file.Close()
+
+	stat, err := file.Stat()
+	require.NoError(t, err)
+
+	duration, err := ReadDuration(file, stat.Size())
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, duration)
+}
+
+func TestParseDuration(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Version  uint8
+		Data     []byte
+		Expected time.Duration
+		Error    bool
+	}{
+		{
+			Name:     "version 0",
+			Data:     []byte("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xac\x44\x00\x01\x58\x88"),
+			Expected: 2 * time.Second,
+		},
+		{
+			Name:     "version 1",
+			Version:  1,
+			Data:     []byte("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x03\xe8\x00\x00\x00\x00\x00\x36\xf0\x74"),
+			Expected: time.Hour + 500*time.Millisecond,
+		},
+		{
+			Name:  "truncated",
+			Data:  []byte("\x00\x00\x00\x00"),
+			Error: true,
+		},
+		{
+			Name:  "zero timescale",
+			Data:  make([]byte, 16),
+			Error: true,
+		},
+		{
+			Name:    "overflowing duration",
+			Version: 1,
+			Data:    []byte("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\xff\xff\xff\xff\xff\xff\xff\xff"),
+			Error:   true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			mvhd := NewBox("mvhd", testCase.Data)
+			mvhd.Version = testCase.Version
+
+			duration, err := parseDuration(mvhd)
+			if testCase.Error {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, testCase.Expected, duration)
+			}
+		})
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Item     string
+		Expected *Metadata
+	}{
+		{
+			Name:     "UTF-8",
+			Item:     "\x00\x00\x00\x1c\xa9nam\x00\x00\x00\x14data\x00\x00\x00\x01\x00\x00\x00\x00Räv",
+			Expected: &Metadata{Title: "Räv"},
+		},
+		{
+			Name:     "UTF-16",
+			Item:     "\x00\x00\x00\x1e\xa9nam\x00\x00\x00\x16data\x00\x00\x00\x02\x00\x00\x00\x00\x00R\x00\xe4\x00v",
+			Expected: &Metadata{Title: "Räv"},
+		},
+		{
+			Name:     "signed integer",
+			Item:     "\x00\x00\x00\x1a\xa9cpy\x00\x00\x00\x12data\x00\x00\x00\x15\x00\x00\x00\x00\xff\xfe",
+			Expected: &Metadata{Copyright: "-2"},
+		},
+		{
+			Name:     "year",
+			Item:     "\x00\x00\x00\x1c\xa9day\x00\x00\x00\x14data\x00\x00\x00\x01\x00\x00\x00\x002024",
+			Expected: &Metadata{Released: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			Name: "invalid date",
+			Item: "\x00\x00\x00\x1c\xa9day\x00\x00\x00\x14data\x00\x00\x00\x01\x00\x00\x00\x00soon",
+			Expected: &Metadata{
+				Unknown: []RawItem{
+					{
+						Type: "\xa9day",
+						Data: []byte("\x00\x00\x00\x14data\x00\x00\x00\x01\x00\x00\x00\x00soon"),
+					},
+				},
+			},
+		},
+		{
+			Name:     "freeform",
+			Item:     "\x00\x00\x00\x41----\x00\x00\x00\x11mean\x00\x00\x00\x00se.sr\x00\x00\x00\x16name\x00\x00\x00\x00episode_id\x00\x00\x00\x12data\x00\x00\x00\x01\x00\x00\x00\x0012",
+			Expected: &Metadata{Freeform: []FreeformItem{{Mean: "se.sr", Name: "episode_id", Value: "12"}}},
+		},
+		{
+			Name: "binary freeform",
+			Item: "\x00\x00\x00\x41----\x00\x00\x00\x11mean\x00\x00\x00\x00se.sr\x00\x00\x00\x16name\x00\x00\x00\x00episode_id\x00\x00\x00\x12data\x00\x00\x00\x00\x00\x00\x00\x00\x01\x02",
+			Expected: &Metadata{
+				Unknown: []RawItem{
+					{
+						Type: "----",
+						Data: []byte("\x00\x00\x00\x11mean\x00\x00\x00\x00se.sr\x00\x00\x00\x16name\x00\x00\x00\x00episode_id\x00\x00\x00\x12data\x00\x00\x00\x00\x00\x00\x00\x00\x01\x02"),
+					},
+				},
+			},
+		},
+		{
+			Name: "JPEG",
+			Item: "\x00\x00\x00\x1a\xa9nam\x00\x00\x00\x12data\x00\x00\x00\x0d\x00\x00\x00\x00\xff\xd8",
+			Expected: &Metadata{
+				Unknown: []RawItem{
+					{
+						Type: "\xa9nam",
+						Data: []byte("\x00\x00\x00\x12data\x00\x00\x00\x0d\x00\x00\x00\x00\xff\xd8"),
+					},
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			actual, err := ParseMetadata([]byte(testCase.Item))
+			require.NoError(t, err)
+			assert.Equal(t, testCase.Expected, actual)
+		})
+	}
+
+	_, err := ParseMetadata([]byte("\x00\x00\x00\xff\xa9nam"))
+	assert.Error(t, err)
+}
+
+func readMetadataFromFile(path string) (*Metadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadMetadata(file, stat.Size())
+}
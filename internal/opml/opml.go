@@ -0,0 +1,88 @@
+// Package opml reads and writes OPML documents, as used by podcast apps to
+// import and export subscriptions.
+//
+// SEE: https://opml.org/spec2.opml
+package opml
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// Document is an OPML document.
+type Document struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    Head     `xml:"head"`
+	Body    Body     `xml:"body"`
+}
+
+// Head contains the document's metadata.
+type Head struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+// Body contains the document's outlines.
+type Body struct {
+	Outlines []Outline `xml:"outline"`
+}
+
+// Outline is an entry in the document, such as a podcast feed. Outlines may be
+// nested, such as podcast apps grouping feeds by category.
+type Outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []Outline `xml:"outline"`
+}
+
+// Feeds returns all outlines with a feed URL, including nested outlines.
+func (d *Document) Feeds() []Outline {
+	feeds := make([]Outline, 0)
+
+	var walk func(outlines []Outline)
+	walk = func(outlines []Outline) {
+		for _, outline := range outlines {
+			if outline.XMLURL != "" {
+				feeds = append(feeds, outline)
+			}
+			walk(outline.Outlines)
+		}
+	}
+	walk(d.Body.Outlines)
+
+	return feeds
+}
+
+// Read parses an OPML document from r.
+func Read(r io.Reader) (*Document, error) {
+	var document Document
+	if err := xml.NewDecoder(r).Decode(&document); err != nil {
+		return nil, err
+	}
+
+	return &document, nil
+}
+
+// Write writes the document to w, including the XML header.
+func (d *Document) Write(w io.Writer) error {
+	if d.Version == "" {
+		d.Version = "2.0"
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(d); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
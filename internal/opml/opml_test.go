@@ -0,0 +1,64 @@
+package opml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWrite(t *testing.T) {
+	document := &Document{
+		Head: Head{Title: "srdl-sub"},
+		Body: Body{
+			Outlines: []Outline{
+				{
+					Text:    "Musikprofessorn",
+					Type:    "rss",
+					XMLURL:  "https://api.sr.se/api/rss/program/5082",
+					HTMLURL: "https://www.sverigesradio.se/musikprofessorn",
+				},
+			},
+		},
+	}
+
+	var builder strings.Builder
+	require.NoError(t, document.Write(&builder))
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head>
+    <title>srdl-sub</title>
+  </head>
+  <body>
+    <outline text="Musikprofessorn" type="rss" xmlUrl="https://api.sr.se/api/rss/program/5082" htmlUrl="https://www.sverigesradio.se/musikprofessorn"></outline>
+  </body>
+</opml>
+`
+	assert.Equal(t, expected, builder.String())
+
+	actual, err := Read(strings.NewReader(builder.String()))
+	require.NoError(t, err)
+	assert.Equal(t, document.Body, actual.Body)
+}
+
+func TestDocumentFeeds(t *testing.T) {
+	// As exported by a podcast app, grouping feeds by category
+	document, err := Read(strings.NewReader(`<?xml version="1.0" encoding="utf-8"?>
+<opml version="1.0">
+  <head><title>Podcasts</title></head>
+  <body>
+    <outline text="Musik">
+      <outline type="rss" text="Musikprofessorn" xmlUrl="https://api.sr.se/api/rss/pod/22185" />
+    </outline>
+    <outline type="rss" text="Text och musik" xmlUrl="https://api.sr.se/api/rss/program/4914" />
+  </body>
+</opml>`))
+	require.NoError(t, err)
+
+	feeds := document.Feeds()
+	require.Len(t, feeds, 2)
+	assert.Equal(t, "https://api.sr.se/api/rss/pod/22185", feeds[0].XMLURL)
+	assert.Equal(t, "https://api.sr.se/api/rss/program/4914", feeds[1].XMLURL)
+}
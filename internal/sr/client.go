@@ -3,10 +3,12 @@ package sr
 import (
 	"context"
 	"encoding/json"
-	"errors"
+	"encoding/xml"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -15,22 +17,28 @@ import (
 	"golang.org/x/net/html"
 )
 
+// DefaultWebBaseURL is the base URL of SR's website.
+const DefaultWebBaseURL = "https://www.sverigesradio.se"
+
 // DefaultClient is the default [Client].
 var DefaultClient = &Client{
-	BaseURL: "https://api.sr.se",
-	Client:  httputil.DefaultClient,
+	BaseURL:    "https://api.sr.se",
+	WebBaseURL: DefaultWebBaseURL,
+	Client:     httputil.DefaultClient,
 }
 
-var (
-	ErrNotFound          = errors.New("not found")
-	ErrProgramIDNotFound = errors.New("program id not found")
-)
-
 type Client struct {
 	// BaseURL is the base URL to the SR APIs.
 	BaseURL string
+	// WebBaseURL is the base URL of SR's website, where program pages are
+	// served. Defaults to [DefaultWebBaseURL].
+	WebBaseURL string
 	// Client is the underlying HTTP client to use.
 	Client *http.Client
+	// OnSchemaWarning enables strict decoding of responses if set. It's called
+	// for each field of a response that is unknown to the models, as well as for
+	// each required field of the models that's missing from a response.
+	OnSchemaWarning func(warning SchemaWarning)
 }
 
 type ListEpisodesInProgramOptions struct {
@@ -86,14 +94,104 @@ func (c *Client) ListEpisodesInProgram(ctx context.Context, programID int, optio
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode == http.StatusNotFound {
-		return nil, ErrNotFound
-	} else if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	if err := checkResponse(res, "application/json"); err != nil {
+		return nil, err
 	}
 
 	var result EpisodesPage
-	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+	if err := c.decode(res.Body, "/v2/episodes/index", &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ListAllEpisodesInProgram lists all episodes of a program, requesting each
+// page of episodes in turn.
+func (c *Client) ListAllEpisodesInProgram(ctx context.Context, programID int) ([]Episode, error) {
+	episodes := make([]Episode, 0)
+	for page := 1; ; page++ {
+		result, err := c.ListEpisodesInProgram(ctx, programID, &ListEpisodesInProgramOptions{
+			Page:     page,
+			PageSize: 100,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		episodes = append(episodes, result.Episodes...)
+
+		if len(result.Episodes) == 0 || page >= result.Pagination.TotalPages {
+			return episodes, nil
+		}
+	}
+}
+
+type ListProgramsOptions struct {
+	// Page [1-n]. Defaults to 1.
+	Page int
+	// PageSize is the number of preferred entries per page.
+	PageSize int
+	// ChannelID optionally limits programs to those of a channel.
+	ChannelID int
+	// CategoryID optionally limits programs to those of a program category.
+	CategoryID int
+}
+
+// ListPrograms lists programs, such as all programs of a channel.
+func (c *Client) ListPrograms(ctx context.Context, options *ListProgramsOptions) (*ProgramsPage, error) {
+	if options == nil {
+		options = &ListProgramsOptions{}
+	}
+
+	page := options.Page
+	if page <= 0 {
+		page = 1
+	}
+
+	pageSize := options.PageSize
+	if pageSize <= 0 {
+		pageSize = 30
+	}
+
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Path = "/v2/programs/index"
+
+	query := make(url.Values)
+	query.Set("format", "json")
+	query.Set("page", strconv.FormatInt(int64(page), 10))
+	query.Set("size", strconv.FormatInt(int64(pageSize), 10))
+	if options.ChannelID > 0 {
+		query.Set("channelid", strconv.FormatInt(int64(options.ChannelID), 10))
+	}
+	if options.CategoryID > 0 {
+		query.Set("programcategoryid", strconv.FormatInt(int64(options.CategoryID), 10))
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res, "application/json"); err != nil {
+		return nil, err
+	}
+
+	var result ProgramsPage
+	if err := c.decode(res.Body, "/v2/programs/index", &result); err != nil {
 		return nil, err
 	}
 
@@ -126,17 +224,16 @@ func (c *Client) GetProgram(ctx context.Context, id int) (*Program, error) {
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode == http.StatusNotFound {
-		return nil, ErrNotFound
-	} else if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	if err := checkResponse(res, "application/json"); err != nil {
+		return nil, err
 	}
 
 	var result struct {
-		Program Program `json:"program"`
+		Copyright string  `json:"copyright,omitempty"`
+		Program   Program `json:"program"`
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+	if err := c.decode(res.Body, "/v2/programs/{id}", &result); err != nil {
 		return nil, err
 	}
 
@@ -174,23 +271,128 @@ func (c *Client) GetEpisode(ctx context.Context, id int) (*Episode, error) {
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode == http.StatusNotFound {
-		return nil, ErrNotFound
-	} else if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	if err := checkResponse(res, "application/json"); err != nil {
+		return nil, err
 	}
 
 	var result struct {
-		Episode Episode `json:"episode"`
+		Copyright string  `json:"copyright,omitempty"`
+		Episode   Episode `json:"episode"`
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+	if err := c.decode(res.Body, "/v2/episodes/get", &result); err != nil {
 		return nil, err
 	}
 
 	return &result.Episode, nil
 }
 
+// ProgramPageURL returns the URL of a program's page based on its slug, such
+// as "textochmusikmedericschuldt".
+func (c *Client) ProgramPageURL(slug string) string {
+	baseURL := c.WebBaseURL
+	if baseURL == "" {
+		baseURL = DefaultWebBaseURL
+	}
+
+	return strings.TrimSuffix(baseURL, "/") + "/" + url.PathEscape(slug)
+}
+
+// ProgramFeedURL returns the URL of a program's RSS feed.
+func (c *Client) ProgramFeedURL(programID int) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + "/api/rss/program/" + strconv.FormatInt(int64(programID), 10)
+}
+
+// IsFeedURL returns whether or not feedURL is the URL of one of SR's RSS feeds,
+// such as "https://api.sr.se/api/rss/pod/22185".
+func (c *Client) IsFeedURL(feedURL string) bool {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return false
+	}
+
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, base.Host) && strings.HasPrefix(u.Path, "/api/rss/")
+}
+
+// GetProgramIDFromFeed returns the program id of a program based on the URL of
+// one of its RSS feeds. Program feeds contain the id in their URL, other feeds,
+// such as pod feeds, are resolved using the link to the program in the feed.
+func (c *Client) GetProgramIDFromFeed(ctx context.Context, feedURL string) (int, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return -1, err
+	}
+
+	if idString, ok := strings.CutPrefix(u.Path, "/api/rss/program/"); ok {
+		id, err := strconv.ParseInt(strings.TrimSuffix(idString, "/"), 10, 32)
+		if err != nil {
+			return -1, fmt.Errorf("invalid program feed url: %w", err)
+		}
+
+		return int(id), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return -1, err
+	}
+
+	req.Header.Set("Accept", "application/rss+xml, application/xml;q=0.9")
+
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res, "application/rss+xml"); err != nil {
+		return -1, err
+	}
+
+	// NOTE: Links in other namespaces, such as atom:link, are matched as well,
+	// but have no content
+	var feed struct {
+		Channel struct {
+			Links []string `xml:"link"`
+		} `xml:"channel"`
+	}
+	if err := xml.NewDecoder(res.Body).Decode(&feed); err != nil {
+		return -1, err
+	}
+
+	for _, link := range feed.Channel.Links {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			continue
+		}
+
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+
+		// Such as https://sverigesradio.se/default.aspx?programid=5082
+		if idString := u.Query().Get("programid"); idString != "" {
+			id, err := strconv.ParseInt(idString, 10, 32)
+			if err != nil {
+				return -1, fmt.Errorf("invalid program link: %w", err)
+			}
+
+			return int(id), nil
+		}
+
+		// Such as https://www.sverigesradio.se/musikprofessorn
+		return c.GetProgramID(ctx, link)
+	}
+
+	return -1, ErrProgramIDNotFound
+}
+
 // GetProgramID return the program id of a program based on its program's page.
 func (c *Client) GetProgramID(ctx context.Context, programPageURL string) (int, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, programPageURL, nil)
@@ -212,13 +414,11 @@ func (c *Client) GetProgramID(ctx context.Context, programPageURL string) (int,
 	if err != nil {
 		return -1, err
 	}
+	defer res.Body.Close()
 
-	if res.StatusCode == http.StatusNotFound {
-		return -1, ErrNotFound
-	} else if res.StatusCode != http.StatusOK {
-		return -1, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	if err := checkResponse(res, "text/html"); err != nil {
+		return -1, err
 	}
-	defer res.Body.Close()
 
 	html, err := html.Parse(res.Body)
 	if err != nil {
@@ -279,19 +479,46 @@ func (c *Client) GetEpisodePlaylist(ctx context.Context, episodeID int) ([]Playl
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode == http.StatusNotFound {
-		return nil, ErrNotFound
-	} else if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	if err := checkResponse(res, "application/json"); err != nil {
+		return nil, err
 	}
 
 	var result struct {
-		Playlist []PlaylistEntry `json:"song"`
+		Copyright string          `json:"copyright,omitempty"`
+		Playlist  []PlaylistEntry `json:"song"`
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+	if err := c.decode(res.Body, "/v2/playlists/getplaylistbyepisodeid", &result); err != nil {
 		return nil, err
 	}
 
 	return result.Playlist, nil
 }
+
+// decode decodes the JSON in r into v. If [Client.OnSchemaWarning] is set, any
+// differences between the JSON and v are reported.
+func (c *Client) decode(r io.Reader, endpoint string, v any) error {
+	if c.OnSchemaWarning == nil {
+		return json.NewDecoder(r).Decode(v)
+	}
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return err
+	}
+
+	var raw any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return err
+	}
+
+	for _, warning := range compareSchema(endpoint, raw, reflect.TypeOf(v)) {
+		c.OnSchemaWarning(warning)
+	}
+
+	return nil
+}
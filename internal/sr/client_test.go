@@ -2,46 +2,244 @@ package sr
 
 import (
 	"context"
-	"encoding/json"
-	"os"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/AlexGustafsson/srdl/internal/httputil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+var update = flag.Bool("update", false, "Record fixtures using the live SR APIs")
+
+// newTestClient returns a client that replays the interactions stored in
+// testdata/<test name>.json. If the -update flag is set, the interactions are
+// instead recorded using the live SR APIs. See testdata/README.md for which
+// interactions are yet to be recorded.
+func newTestClient(t *testing.T) *Client {
+	path := filepath.Join("testdata", t.Name()+".json")
+
+	mode := httputil.RecorderModeReplay
+	if *update {
+		mode = httputil.RecorderModeRecord
+	}
+
+	transport, err := httputil.NewRecorderTransport(path, mode)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Save())
+	})
+
+	return &Client{
+		BaseURL: DefaultClient.BaseURL,
+		Client:  &http.Client{Transport: transport},
+	}
+}
+
 func TestClientListEpisodesInProgram(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
+	client := newTestClient(t)
+
+	result, err := client.ListEpisodesInProgram(context.TODO(), 4914, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.Pagination.Page)
+	require.NotEmpty(t, result.Episodes)
+
+	for _, episode := range result.Episodes {
+		assert.NotZero(t, episode.ID)
+		assert.NotEmpty(t, episode.Title)
+		assert.Equal(t, 4914, episode.Program.ID)
+		assert.False(t, episode.PublishDate.IsZero())
+		require.NotNil(t, episode.Broadcast)
+		require.NotEmpty(t, episode.Broadcast.Files)
+		assert.NotEmpty(t, episode.Broadcast.Files[0].URL)
 	}
+}
+
+func TestClientListAllEpisodesInProgram(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/episodes/index" || r.URL.Query().Get("programid") != "4914" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Write([]byte(`{"pagination":{"page":1,"size":2,"totalhits":3,"totalpages":2},"episodes":[{"id":1,"title":"A"},{"id":2,"title":"B"}]}`))
+		case "2":
+			w.Write([]byte(`{"pagination":{"page":2,"size":2,"totalhits":3,"totalpages":2},"episodes":[{"id":3,"title":"C"}]}`))
+		default:
+			w.Write([]byte(`{"pagination":{"page":3,"size":2,"totalhits":3,"totalpages":2},"episodes":[]}`))
+		}
+	}))
+	defer server.Close()
 
-	result, err := DefaultClient.ListEpisodesInProgram(context.TODO(), 4914, nil)
+	client := &Client{BaseURL: server.URL, Client: server.Client()}
+
+	episodes, err := client.ListAllEpisodesInProgram(context.TODO(), 4914)
 	require.NoError(t, err)
 
-	encoder := json.NewEncoder(os.Stdout)
-	encoder.SetIndent("", "  ")
-	require.NoError(t, encoder.Encode(&result))
+	ids := make([]int, 0)
+	for _, episode := range episodes {
+		ids = append(ids, episode.ID)
+	}
+	assert.Equal(t, []int{1, 2, 3}, ids)
+
+	_, err = client.ListAllEpisodesInProgram(context.TODO(), 1)
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
-func TestClientGetProgramID(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
+func TestClientListPrograms(t *testing.T) {
+	client := newTestClient(t)
+
+	result, err := client.ListPrograms(context.TODO(), &ListProgramsOptions{ChannelID: 163, CategoryID: 5})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.Pagination.Page)
+	require.NotEmpty(t, result.Programs)
+
+	for _, program := range result.Programs {
+		assert.NotZero(t, program.ID)
+		assert.NotEmpty(t, program.Name)
+		assert.Equal(t, 163, program.Channel.ID)
+		assert.Equal(t, 5, program.Category.ID)
 	}
+}
 
-	id, err := DefaultClient.GetProgramID(context.TODO(), "https://www.sverigesradio.se/textochmusikmedericschuldt")
+func TestClientGetProgram(t *testing.T) {
+	client := newTestClient(t)
+
+	program, err := client.GetProgram(context.TODO(), 4914)
+	require.NoError(t, err)
+
+	assert.Equal(t, 4914, program.ID)
+	assert.Equal(t, "Text och musik med Eric Schüldt", program.Name)
+	assert.Equal(t, "textochmusikmedericschuldt", program.Slug)
+	assert.Equal(t, ProgramCategory{ID: 5, Name: "Musik"}, program.Category)
+	assert.Equal(t, ChannelReference{ID: 163, Name: "P2"}, program.Channel)
+	assert.NotEmpty(t, program.ImageURL)
+	assert.NotEmpty(t, program.ImageTemplateWideURL)
+
+	_, err = client.GetProgram(context.TODO(), 1)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestClientGetEpisode(t *testing.T) {
+	client := newTestClient(t)
+
+	episode, err := client.GetEpisode(context.TODO(), 2531337)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2531337, episode.ID)
+	assert.Equal(t, 5082, episode.Program.ID)
+	assert.Equal(t, time.Date(2025, 8, 5, 5, 0, 0, 0, time.UTC), episode.PublishDate.Time)
+	require.NotNil(t, episode.PodFile)
+	assert.NotEmpty(t, episode.PodFile.URL)
+	assert.Equal(t, 1740, episode.PodFile.Duration)
+}
+
+func TestClientGetProgramID(t *testing.T) {
+	client := newTestClient(t)
+
+	id, err := client.GetProgramID(context.TODO(), "https://www.sverigesradio.se/textochmusikmedericschuldt")
 	require.NoError(t, err)
 	assert.Equal(t, 4914, id)
 }
 
-func TestClientGetEpisodePlaylist(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
+func TestClientProgramPageURL(t *testing.T) {
+	assert.Equal(t, "https://www.sverigesradio.se/textochmusikmedericschuldt", (&Client{}).ProgramPageURL("textochmusikmedericschuldt"))
+	assert.Equal(t, "http://localhost/musikprofessorn", (&Client{WebBaseURL: "http://localhost/"}).ProgramPageURL("musikprofessorn"))
+}
+
+func TestClientProgramFeedURL(t *testing.T) {
+	client := &Client{BaseURL: "https://api.sr.se"}
+	assert.Equal(t, "https://api.sr.se/api/rss/program/4914", client.ProgramFeedURL(4914))
+	assert.True(t, client.IsFeedURL("https://api.sr.se/api/rss/pod/22185"))
+	assert.True(t, client.IsFeedURL(client.ProgramFeedURL(4914)))
+	assert.False(t, client.IsFeedURL("https://api.sr.se/v2/programs/4914"))
+	assert.False(t, client.IsFeedURL("https://example.com/api/rss/pod/22185"))
+}
+
+func TestClientGetProgramIDFromFeed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/rss/pod/22185":
+			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+	<channel>
+		<atom:link href="https://api.sr.se/api/rss/pod/22185" rel="self" type="application/rss+xml" />
+		<title>Musikprofessorn</title>
+		<link>https://sverigesradio.se/default.aspx?programid=5082</link>
+	</channel>
+</rss>`))
+		case "/api/rss/pod/1":
+			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+			w.Write([]byte(`<rss version="2.0"><channel><title>Empty</title></channel></rss>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL, Client: server.Client()}
+
+	testCases := []struct {
+		Name     string
+		URL      string
+		Expected int
+		Error    error
+	}{
+		{
+			Name:     "program feed",
+			URL:      server.URL + "/api/rss/program/4914",
+			Expected: 4914,
+		},
+		{
+			Name:     "pod feed",
+			URL:      server.URL + "/api/rss/pod/22185",
+			Expected: 5082,
+		},
+		{
+			Name:  "feed without link",
+			URL:   server.URL + "/api/rss/pod/1",
+			Error: ErrProgramIDNotFound,
+		},
+		{
+			Name:  "missing feed",
+			URL:   server.URL + "/api/rss/pod/2",
+			Error: ErrNotFound,
+		},
 	}
 
-	result, err := DefaultClient.GetEpisodePlaylist(context.TODO(), 2479556)
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			id, err := client.GetProgramIDFromFeed(context.TODO(), testCase.URL)
+			if testCase.Error != nil {
+				assert.ErrorIs(t, err, testCase.Error)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, testCase.Expected, id)
+			}
+		})
+	}
+}
+
+func TestClientGetEpisodePlaylist(t *testing.T) {
+	client := newTestClient(t)
+
+	result, err := client.GetEpisodePlaylist(context.TODO(), 2479556)
 	require.NoError(t, err)
 
-	encoder := json.NewEncoder(os.Stdout)
-	encoder.SetIndent("", "  ")
-	require.NoError(t, encoder.Encode(&result))
+	require.NotEmpty(t, result)
+	for _, entry := range result {
+		assert.NotEmpty(t, entry.Title)
+		assert.False(t, entry.StartTime.IsZero())
+	}
 }
@@ -0,0 +1,141 @@
+package sr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrProgramIDNotFound = errors.New("program id not found")
+	// ErrRateLimited is matched by [APIError] when the request was rejected
+	// due to rate limiting.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrBlocked is matched by [APIError] when the request was blocked, such as
+	// by SR's WAF.
+	ErrBlocked = errors.New("blocked")
+)
+
+// maxBodyExcerptLength is the maximum number of bytes of a response body kept
+// in an [APIError].
+const maxBodyExcerptLength = 512
+
+// requestIDHeaders are headers that may identify a request, in order of
+// preference.
+var requestIDHeaders = []string{
+	"X-Request-Id",
+	"X-Correlation-Id",
+	"X-Azure-Ref",
+	"X-Amz-Cf-Id",
+	"Cf-Ray",
+}
+
+// APIError is returned by [Client] when an SR endpoint responds with an
+// unexpected status code or content.
+//
+// APIError matches [ErrNotFound], [ErrRateLimited] and [ErrBlocked] using
+// [errors.Is].
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// RequestID is the value of the first found request id header, if any.
+	RequestID string
+	// RetryAfter is the delay requested by the server before retrying, if any.
+	RetryAfter time.Duration
+	// Body is an excerpt of the response body.
+	Body string
+	// Blocked is whether or not the response seems to be from a WAF rather than
+	// the requested endpoint.
+	Blocked bool
+}
+
+// Error implements error.
+func (e *APIError) Error() string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "%s %s: ", e.Method, e.URL)
+	if e.Blocked {
+		builder.WriteString("blocked: ")
+	}
+	fmt.Fprintf(&builder, "unexpected status code: %d", e.StatusCode)
+
+	if e.RequestID != "" {
+		fmt.Fprintf(&builder, " (request id %s)", e.RequestID)
+	}
+
+	return builder.String()
+}
+
+// Is implements errors.Is.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrBlocked:
+		return e.Blocked
+	default:
+		return false
+	}
+}
+
+// newAPIError returns an [APIError] describing res.
+// The response body is read, but not closed.
+func newAPIError(res *http.Response, blocked bool) *APIError {
+	err := &APIError{
+		StatusCode: res.StatusCode,
+		Blocked:    blocked || res.StatusCode == http.StatusForbidden,
+	}
+
+	if res.Request != nil {
+		err.Method = res.Request.Method
+		err.URL = res.Request.URL.String()
+	}
+
+	for _, header := range requestIDHeaders {
+		if value := res.Header.Get(header); value != "" {
+			err.RequestID = value
+			break
+		}
+	}
+
+	if value := res.Header.Get("Retry-After"); value != "" {
+		if seconds, parseErr := strconv.ParseInt(value, 10, 64); parseErr == nil {
+			err.RetryAfter = time.Duration(seconds) * time.Second
+		} else if date, parseErr := http.ParseTime(value); parseErr == nil {
+			err.RetryAfter = max(time.Until(date), 0)
+		}
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxBodyExcerptLength))
+	// Don't cut a rune in half
+	for len(body) > 0 && !utf8.Valid(body) {
+		body = body[:len(body)-1]
+	}
+	err.Body = string(body)
+
+	return err
+}
+
+// checkResponse returns an [APIError] if res does not have the status code 200
+// or if it does not have the expected media type. A HTML response to a request
+// expecting another media type is treated as a block by SR's WAF.
+func checkResponse(res *http.Response, expectedMediaType string) error {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	blocked := mediaType == "text/html" && expectedMediaType != "text/html"
+
+	if res.StatusCode != http.StatusOK || blocked {
+		return newAPIError(res, blocked)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package sr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientAPIError(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		StatusCode  int
+		ContentType string
+		Header      http.Header
+		Body        string
+		Expected    APIError
+		Matches     []error
+	}{
+		{
+			Name:        "Not found",
+			StatusCode:  http.StatusNotFound,
+			ContentType: "application/json",
+			Header:      http.Header{"X-Request-Id": {"abc"}},
+			Body:        `{"error":"not found"}`,
+			Expected: APIError{
+				StatusCode: http.StatusNotFound,
+				RequestID:  "abc",
+				Body:       `{"error":"not found"}`,
+			},
+			Matches: []error{ErrNotFound},
+		},
+		{
+			Name:        "Rate limited",
+			StatusCode:  http.StatusTooManyRequests,
+			ContentType: "text/plain",
+			Header:      http.Header{"Retry-After": {"120"}},
+			Body:        "Too many requests",
+			Expected: APIError{
+				StatusCode: http.StatusTooManyRequests,
+				RetryAfter: 2 * time.Minute,
+				Body:       "Too many requests",
+			},
+			Matches: []error{ErrRateLimited},
+		},
+		{
+			Name:        "WAF block page",
+			StatusCode:  http.StatusOK,
+			ContentType: "text/html; charset=utf-8",
+			Body:        "<html><body>Request rejected</body></html>",
+			Expected: APIError{
+				StatusCode: http.StatusOK,
+				Body:       "<html><body>Request rejected</body></html>",
+				Blocked:    true,
+			},
+			Matches: []error{ErrBlocked},
+		},
+		{
+			Name:        "Forbidden",
+			StatusCode:  http.StatusForbidden,
+			ContentType: "text/html",
+			Body:        strings.Repeat("a", 1024),
+			Expected: APIError{
+				StatusCode: http.StatusForbidden,
+				Body:       strings.Repeat("a", maxBodyExcerptLength),
+				Blocked:    true,
+			},
+			Matches: []error{ErrBlocked},
+		},
+		{
+			Name:        "Server error",
+			StatusCode:  http.StatusInternalServerError,
+			ContentType: "application/json",
+			Body:        "{}",
+			Expected: APIError{
+				StatusCode: http.StatusInternalServerError,
+				Body:       "{}",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range testCase.Header {
+					w.Header()[k] = v
+				}
+				w.Header().Set("Content-Type", testCase.ContentType)
+				w.WriteHeader(testCase.StatusCode)
+				w.Write([]byte(testCase.Body))
+			}))
+			defer server.Close()
+
+			client := &Client{BaseURL: server.URL, Client: server.Client()}
+
+			_, err := client.GetProgram(context.TODO(), 4914)
+			require.Error(t, err)
+
+			var apiErr *APIError
+			require.True(t, errors.As(err, &apiErr))
+
+			expected := testCase.Expected
+			expected.Method = http.MethodGet
+			expected.URL = server.URL + "/v2/programs/4914?format=json"
+			assert.Equal(t, &expected, apiErr)
+
+			for _, target := range []error{ErrNotFound, ErrRateLimited, ErrBlocked} {
+				assert.Equal(t, errors.Is(err, target), slices.Contains(testCase.Matches, target), "errors.Is(err, %v)", target)
+			}
+		})
+	}
+}
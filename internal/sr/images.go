@@ -0,0 +1,26 @@
+package sr
+
+import (
+	"net/url"
+)
+
+// ImageURL returns the URL to the image described by templateURL, such as
+// [Program.ImageTemplateURL], using preset. Presets are either named, such as
+// "api-default-square", or sizes, such as "2048x1152". If preset is empty, or
+// templateURL is invalid, templateURL is returned.
+func ImageURL(templateURL string, preset string) string {
+	if templateURL == "" || preset == "" {
+		return templateURL
+	}
+
+	u, err := url.Parse(templateURL)
+	if err != nil {
+		return templateURL
+	}
+
+	query := u.Query()
+	query.Set("preset", preset)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,45 @@
+package sr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageURL(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		TemplateURL string
+		Preset      string
+		Expected    string
+	}{
+		{
+			Name:        "Size preset",
+			TemplateURL: "https://static-cdn.sr.se/images/4914/74ebbeb2-9948-499b-9bc9-94cffd2d456a.jpg",
+			Preset:      "2048x1152",
+			Expected:    "https://static-cdn.sr.se/images/4914/74ebbeb2-9948-499b-9bc9-94cffd2d456a.jpg?preset=2048x1152",
+		},
+		{
+			Name:        "Replaces existing preset",
+			TemplateURL: "https://static-cdn.sr.se/images/4914/dd5ffd1e-5548-4f2e-87ea-0ab681a23855.jpg?preset=api-default-square",
+			Preset:      "api-default-rectangle",
+			Expected:    "https://static-cdn.sr.se/images/4914/dd5ffd1e-5548-4f2e-87ea-0ab681a23855.jpg?preset=api-default-rectangle",
+		},
+		{
+			Name:        "No preset",
+			TemplateURL: "https://static-cdn.sr.se/images/4914/dd5ffd1e-5548-4f2e-87ea-0ab681a23855.jpg",
+			Expected:    "https://static-cdn.sr.se/images/4914/dd5ffd1e-5548-4f2e-87ea-0ab681a23855.jpg",
+		},
+		{
+			Name:     "No template",
+			Preset:   "2048x1152",
+			Expected: "",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			assert.Equal(t, testCase.Expected, ImageURL(testCase.TemplateURL, testCase.Preset))
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,10 +16,17 @@ type Pagination struct {
 }
 
 type EpisodesPage struct {
+	Copyright  string     `json:"copyright,omitempty"`
 	Pagination Pagination `json:"pagination"`
 	Episodes   []Episode  `json:"episodes"`
 }
 
+type ProgramsPage struct {
+	Copyright  string     `json:"copyright,omitempty"`
+	Pagination Pagination `json:"pagination"`
+	Programs   []Program  `json:"programs"`
+}
+
 type Episode struct {
 	ID                int              `json:"id"`
 	Title             string           `json:"title"`
@@ -81,44 +89,118 @@ type PodFile struct {
 	URL             string           `json:"url"`
 }
 
+// Time is a time encoded using the Microsoft JSON date format, such as
+// "/Date(1728810000000)/" or "/Date(1728810000000+0200)/".
+//
+// The number is the milliseconds since the UNIX epoch, in UTC. The optional
+// offset only describes the time zone of the time, it does not affect the
+// instant.
+//
+// See: https://learn.microsoft.com/en-us/previous-versions/dotnet/articles/bb299886(v=msdn.10)#from-javascript-literals-to-json
 type Time struct {
 	time.Time
 }
 
-func (t *Time) UnmarshalJSON(b []byte) error {
-	if len(b) == 0 {
-		*t = Time{
-			Time: time.Time{},
+// ParseTime parses a time using the Microsoft JSON date format.
+func ParseTime(s string) (Time, error) {
+	digits, ok := strings.CutPrefix(s, "/Date(")
+	if ok {
+		digits, ok = strings.CutSuffix(digits, ")/")
+	}
+	if !ok {
+		return Time{}, fmt.Errorf("invalid sr time: expected /Date(...)/")
+	}
+
+	// The offset is the last sign that's not at the start
+	offsetIndex := strings.LastIndexAny(digits, "+-")
+	var offset string
+	if offsetIndex > 0 {
+		offset = digits[offsetIndex:]
+		digits = digits[:offsetIndex]
+	}
+
+	ms, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Time{}, fmt.Errorf("invalid sr time: %w", err)
+	}
+
+	t := time.UnixMilli(ms).UTC()
+
+	if offset != "" {
+		if len(offset) != 5 {
+			return Time{}, fmt.Errorf("invalid sr time: invalid offset")
 		}
-		return nil
+
+		hours, err := strconv.ParseUint(offset[1:3], 10, 8)
+		if err != nil || hours > 23 {
+			return Time{}, fmt.Errorf("invalid sr time: invalid offset")
+		}
+
+		minutes, err := strconv.ParseUint(offset[3:5], 10, 8)
+		if err != nil || minutes > 59 {
+			return Time{}, fmt.Errorf("invalid sr time: invalid offset")
+		}
+
+		seconds := int(hours)*60*60 + int(minutes)*60
+		if offset[0] == '-' {
+			seconds = -seconds
+		}
+
+		t = t.In(time.FixedZone("", seconds))
 	}
 
-	var s string
-	if err := json.Unmarshal(b, &s); err != nil {
-		return nil
+	return Time{Time: t}, nil
+}
+
+// String returns the time formatted using the Microsoft JSON date format.
+// Times without an offset from UTC are formatted without an offset. Precision
+// beyond milliseconds is lost.
+func (t Time) String() string {
+	ms := strconv.FormatInt(t.UnixMilli(), 10)
+
+	_, offset := t.Zone()
+	if offset == 0 {
+		return "/Date(" + ms + ")/"
 	}
 
-	// Expected format: "/Date(1728810000000)/"
-	if len(s) != 21 {
-		return fmt.Errorf("invalid sr time: invalid length")
+	sign := byte('+')
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
 	}
 
-	ts, err := strconv.ParseInt(s[6:19], 10, 64)
-	if err != nil {
+	return fmt.Sprintf("/Date(%s%c%02d%02d)/", ms, sign, offset/(60*60), (offset/60)%60)
+}
+
+func (t *Time) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*t = Time{}
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
 		return fmt.Errorf("invalid sr time: %w", err)
 	}
 
-	sec := ts / 1000
-	nsec := int64((float64)(ts)/1000 - (float64)(sec))
-	*t = Time{
-		Time: time.Unix(sec, nsec).UTC(),
+	parsed, err := ParseTime(s)
+	if err != nil {
+		return err
 	}
 
+	*t = parsed
 	return nil
 }
 
-func (t *Time) MarshalJSON() ([]byte, error) {
-	return []byte(fmt.Sprintf(`"/Date(%d)/"`, t.UnixMilli())), nil
+// MarshalJSON implements [json.Marshaler]. The zero time is marshalled as null.
+// The zero instant with an offset from UTC is marshalled as is, so that the
+// offset is kept.
+func (t Time) MarshalJSON() ([]byte, error) {
+	if _, offset := t.Zone(); t.IsZero() && offset == 0 {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(t.String())
 }
 
 type Program struct {
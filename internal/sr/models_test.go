@@ -3,6 +3,7 @@ package sr
 import (
 	"encoding/json"
 	"testing"
+	"testing/quick"
 	"time"
 
 	"github.com/stretchr/testify/assert"
@@ -22,3 +23,187 @@ func TestTimeUnmarshal(t *testing.T) {
 	require.NoError(t, json.Unmarshal([]byte(`"/Date(1728810000000)/"`), &actual))
 	assert.Equal(t, expected, actual.Time)
 }
+
+func TestTimeUnmarshalGrammar(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Value    string
+		Expected time.Time
+		Fails    bool
+	}{
+		{
+			Name:     "Milliseconds",
+			Value:    `"/Date(1728810000123)/"`,
+			Expected: time.Date(2024, 10, 13, 9, 0, 0, 123_000_000, time.UTC),
+		},
+		{
+			Name:     "Negative",
+			Value:    `"/Date(-1000)/"`,
+			Expected: time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			Name:     "Short",
+			Value:    `"/Date(0)/"`,
+			Expected: time.Unix(0, 0).UTC(),
+		},
+		{
+			Name:     "Positive offset",
+			Value:    `"/Date(1728810000000+0200)/"`,
+			Expected: time.Date(2024, 10, 13, 11, 0, 0, 0, time.FixedZone("", 2*60*60)),
+		},
+		{
+			Name:     "Negative offset",
+			Value:    `"/Date(1728810000000-0130)/"`,
+			Expected: time.Date(2024, 10, 13, 7, 30, 0, 0, time.FixedZone("", -90*60)),
+		},
+		{
+			Name:     "Negative with offset",
+			Value:    `"/Date(-1000+0100)/"`,
+			Expected: time.Date(1970, 1, 1, 0, 59, 59, 0, time.FixedZone("", 60*60)),
+		},
+		{
+			Name:     "Null",
+			Value:    `null`,
+			Expected: time.Time{},
+		},
+		{
+			Name:  "Number",
+			Value: `1728810000000`,
+			Fails: true,
+		},
+		{
+			Name:  "Missing prefix",
+			Value: `"1728810000000"`,
+			Fails: true,
+		},
+		{
+			Name:  "Missing suffix",
+			Value: `"/Date(1728810000000)"`,
+			Fails: true,
+		},
+		{
+			Name:  "Empty",
+			Value: `"/Date()/"`,
+			Fails: true,
+		},
+		{
+			Name:  "Invalid offset",
+			Value: `"/Date(1728810000000+02)/"`,
+			Fails: true,
+		},
+		{
+			Name:  "Out of range offset",
+			Value: `"/Date(1728810000000+0260)/"`,
+			Fails: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			var actual Time
+			err := json.Unmarshal([]byte(testCase.Value), &actual)
+			if testCase.Fails {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.True(t, testCase.Expected.Equal(actual.Time), "expected %s, got %s", testCase.Expected, actual.Time)
+				_, expectedOffset := testCase.Expected.Zone()
+				_, actualOffset := actual.Zone()
+				assert.Equal(t, expectedOffset, actualOffset)
+			}
+		})
+	}
+}
+
+func TestTimeMarshalValue(t *testing.T) {
+	// Time is marshalled the same way when not addressable
+	value := struct {
+		Time Time `json:"time"`
+	}{
+		Time: Time{Time: time.Unix(1728810000, 0).UTC()},
+	}
+
+	actual, err := json.Marshal(value)
+	require.NoError(t, err)
+	assert.Equal(t, `{"time":"/Date(1728810000000)/"}`, string(actual))
+
+	actual, err = json.Marshal(Time{Time: time.Unix(1728810000, 0).In(time.FixedZone("CEST", 2*60*60))})
+	require.NoError(t, err)
+	assert.Equal(t, `"/Date(1728810000000+0200)/"`, string(actual))
+
+	actual, err = json.Marshal(Time{})
+	require.NoError(t, err)
+	assert.Equal(t, `null`, string(actual))
+
+	// The zero instant keeps its offset
+	zero, err := ParseTime("/Date(-62135596800000+0100)/")
+	require.NoError(t, err)
+	actual, err = json.Marshal(zero)
+	require.NoError(t, err)
+	assert.Equal(t, `"/Date(-62135596800000+0100)/"`, string(actual))
+}
+
+func TestTimeRoundTrip(t *testing.T) {
+	property := func(ms int64, offsetMinutes int16) bool {
+		// Limit the values to the range supported by the format
+		ms %= 1 << 50
+		offsetMinutes %= 24 * 60
+
+		expected := Time{Time: time.UnixMilli(ms).In(time.FixedZone("", int(offsetMinutes)*60))}
+		return roundTrips(expected)
+	}
+
+	require.NoError(t, quick.Check(property, nil))
+}
+
+func FuzzTimeRoundTrip(f *testing.F) {
+	f.Add(int64(1728810000000), int16(0))
+	f.Add(int64(-1), int16(120))
+	f.Add(int64(0), int16(-90))
+
+	f.Fuzz(func(t *testing.T, ms int64, offsetMinutes int16) {
+		ms %= 1 << 50
+		offsetMinutes %= 24 * 60
+
+		expected := Time{Time: time.UnixMilli(ms).In(time.FixedZone("", int(offsetMinutes)*60))}
+		if !roundTrips(expected) {
+			t.Fatalf("%s does not round-trip", expected)
+		}
+	})
+}
+
+func FuzzParseTime(f *testing.F) {
+	f.Add("/Date(1728810000000)/")
+	f.Add("/Date(1728810000000+0200)/")
+	f.Add("/Date(-1000-0130)/")
+	f.Add("/Date(-62135596800000+0100)/")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		parsed, err := ParseTime(s)
+		if err != nil {
+			return
+		}
+
+		if !roundTrips(parsed) {
+			t.Fatalf("%q does not round-trip", s)
+		}
+	})
+}
+
+// roundTrips returns whether or not expected is equal to itself after being
+// marshalled and unmarshalled.
+func roundTrips(expected Time) bool {
+	b, err := json.Marshal(expected)
+	if err != nil {
+		return false
+	}
+
+	var actual Time
+	if err := json.Unmarshal(b, &actual); err != nil {
+		return false
+	}
+
+	_, expectedOffset := expected.Zone()
+	_, actualOffset := actual.Zone()
+	return expected.Equal(actual.Time) && expectedOffset == actualOffset
+}
@@ -0,0 +1,138 @@
+package sr
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// SchemaWarningKind is the kind of a [SchemaWarning].
+type SchemaWarningKind string
+
+const (
+	// SchemaWarningUnknownField is used for fields that are part of a response,
+	// but not part of the model.
+	SchemaWarningUnknownField SchemaWarningKind = "unknown"
+	// SchemaWarningMissingField is used for required fields that are part of the
+	// model, but not part of a response.
+	SchemaWarningMissingField SchemaWarningKind = "missing"
+)
+
+// SchemaWarning describes a difference between an API response and the
+// model it's decoded into.
+type SchemaWarning struct {
+	Kind SchemaWarningKind `json:"kind"`
+	// Endpoint is the path of the endpoint that returned the response, such as
+	// "/v2/episodes/get".
+	Endpoint string `json:"endpoint"`
+	// Path is the path of the field in the response, such as
+	// "episode.broadcast.broadcastfiles[].url".
+	Path string `json:"path"`
+}
+
+func (w SchemaWarning) String() string {
+	return fmt.Sprintf("%s: %s field %s", w.Endpoint, w.Kind, w.Path)
+}
+
+var timeType = reflect.TypeFor[Time]()
+
+// compareSchema compares the decoded JSON value raw to the type t, returning
+// any differences. Fields tagged with omitempty are considered optional.
+func compareSchema(endpoint string, raw any, t reflect.Type) []SchemaWarning {
+	warnings := make([]SchemaWarning, 0)
+	seen := make(map[SchemaWarning]struct{})
+
+	var compare func(raw any, t reflect.Type, path string)
+	compare = func(raw any, t reflect.Type, path string) {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+
+		if raw == nil || t == timeType {
+			return
+		}
+
+		warn := func(kind SchemaWarningKind, path string) {
+			warning := SchemaWarning{Kind: kind, Endpoint: endpoint, Path: path}
+			if _, ok := seen[warning]; !ok {
+				seen[warning] = struct{}{}
+				warnings = append(warnings, warning)
+			}
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			object, ok := raw.(map[string]any)
+			if !ok {
+				return
+			}
+
+			known := make(map[string]struct{})
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				if !field.IsExported() {
+					continue
+				}
+
+				name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if name == "-" {
+					continue
+				} else if name == "" {
+					name = field.Name
+				}
+				known[name] = struct{}{}
+
+				value, ok := object[name]
+				if !ok {
+					if !slices.Contains(strings.Split(options, ","), "omitempty") {
+						warn(SchemaWarningMissingField, joinSchemaPath(path, name))
+					}
+					continue
+				}
+
+				compare(value, field.Type, joinSchemaPath(path, name))
+			}
+
+			for name := range object {
+				if _, ok := known[name]; !ok {
+					warn(SchemaWarningUnknownField, joinSchemaPath(path, name))
+				}
+			}
+		case reflect.Slice, reflect.Array:
+			array, ok := raw.([]any)
+			if !ok {
+				return
+			}
+
+			for _, value := range array {
+				compare(value, t.Elem(), path+"[]")
+			}
+		case reflect.Map:
+			object, ok := raw.(map[string]any)
+			if !ok {
+				return
+			}
+
+			for _, value := range object {
+				compare(value, t.Elem(), path+"{}")
+			}
+		}
+	}
+
+	compare(raw, t, "")
+
+	slices.SortFunc(warnings, func(a SchemaWarning, b SchemaWarning) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return warnings
+}
+
+func joinSchemaPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
@@ -0,0 +1,70 @@
+package sr
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareSchema(t *testing.T) {
+	body := `{
+  "episode": {
+    "id": 2522448,
+    "title": "Carpe diem",
+    "description": "",
+    "url": "https://www.sverigesradio.se/avsnitt/2522448",
+    "program": {"id": 4914, "name": "Text och musik med Eric Schüldt"},
+    "audiopreference": "default",
+    "audiopriority": "aac",
+    "audiopresentation": "format",
+    "publishdateutc": "/Date(1753002000000)/",
+    "imageurl": "",
+    "imageurltemplate": "",
+    "broadcast": {
+      "availablestoputc": "/Date(1755597540000)/",
+      "broadcastfiles": [
+        {"duration": 3540, "publishdateutc": "/Date(1753002000000)/", "id": 1, "url": "", "statkey": "", "bitrate": 96},
+        {"duration": 3540, "publishdateutc": "/Date(1753002000000)/", "id": 2, "url": "", "statkey": "", "bitrate": 96}
+      ]
+    },
+    "listenpodfile": {}
+  }
+}`
+
+	var raw any
+	require.NoError(t, json.Unmarshal([]byte(body), &raw))
+
+	var result struct {
+		Episode Episode `json:"episode"`
+	}
+
+	expected := []SchemaWarning{
+		{Kind: SchemaWarningUnknownField, Endpoint: "/v2/episodes/get", Path: "episode.broadcast.broadcastfiles[].bitrate"},
+		{Kind: SchemaWarningUnknownField, Endpoint: "/v2/episodes/get", Path: "episode.listenpodfile"},
+		{Kind: SchemaWarningMissingField, Endpoint: "/v2/episodes/get", Path: "episode.photographer"},
+	}
+
+	actual := compareSchema("/v2/episodes/get", raw, reflect.TypeOf(&result))
+	assert.Equal(t, expected, actual)
+}
+
+func TestClientDecodeStrict(t *testing.T) {
+	warnings := make([]SchemaWarning, 0)
+	client := &Client{
+		OnSchemaWarning: func(warning SchemaWarning) {
+			warnings = append(warnings, warning)
+		},
+	}
+
+	var result Pagination
+	require.NoError(t, client.decode(strings.NewReader(`{"page": 1, "size": 10, "totalhits": 1, "totalpages": 1, "nextpage": ""}`), "/v2/episodes/index", &result))
+
+	assert.Equal(t, Pagination{Page: 1, Size: 10, TotalHits: 1, TotalPages: 1}, result)
+	assert.Equal(t, []SchemaWarning{
+		{Kind: SchemaWarningUnknownField, Endpoint: "/v2/episodes/index", Path: "nextpage"},
+	}, warnings)
+}
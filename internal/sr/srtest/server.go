@@ -0,0 +1,500 @@
+// Package srtest provides an offline fake of the SR APIs for use in tests.
+package srtest
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/sr"
+)
+
+//go:embed fixtures
+var fixtures embed.FS
+
+var programPageTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html lang="sv">
+	<head>
+		<meta property="og:title" content="{{.Name}} - alla avsnitt" />
+		<meta property="og:description" content="{{.Description}}" />
+		<meta property="al:android:url" content="sesrplay://play/program/{{.ID}}" />
+	</head>
+	<body></body>
+</html>`))
+
+type file struct {
+	ContentType string
+	Content     []byte
+}
+
+// Server is a fake of the SR endpoints used by [sr.Client].
+// URLs to audio files and images in programs and episodes added to the server
+// are rewritten to point to the server itself.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	programs  map[int]sr.Program
+	episodes  map[int]sr.Episode
+	playlists map[int][]sr.PlaylistEntry
+	files     map[string]file
+	blocked   bool
+	requests  map[string]int
+}
+
+// NewServer starts and returns a new server, seeded with the fixtures in
+// the fixtures directory. The caller should call Close when finished, to shut
+// it down.
+func NewServer() *Server {
+	s := NewEmptyServer()
+
+	if err := s.loadFixtures(); err != nil {
+		s.Close()
+		panic(fmt.Errorf("srtest: failed to load fixtures: %w", err))
+	}
+
+	return s
+}
+
+// NewEmptyServer starts and returns a new server without any programs or
+// episodes. The caller should call Close when finished, to shut it down.
+func NewEmptyServer() *Server {
+	s := &Server{
+		programs:  make(map[int]sr.Program),
+		episodes:  make(map[int]sr.Episode),
+		playlists: make(map[int][]sr.PlaylistEntry),
+		files:     make(map[string]file),
+		requests:  make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/programs/index", s.handleListPrograms)
+	mux.HandleFunc("GET /v2/programs/{id}", s.handleGetProgram)
+	mux.HandleFunc("GET /v2/episodes/index", s.handleListEpisodes)
+	mux.HandleFunc("GET /v2/episodes/get", s.handleGetEpisode)
+	mux.HandleFunc("GET /v2/playlists/getplaylistbyepisodeid", s.handleGetPlaylist)
+	mux.HandleFunc("GET /", s.handleFallback)
+
+	s.Server = httptest.NewServer(s.blockingHandler(mux))
+	return s
+}
+
+// Client returns a [sr.Client] configured to use the server.
+func (s *Server) Client() *sr.Client {
+	return &sr.Client{
+		BaseURL:    s.URL,
+		WebBaseURL: s.URL,
+		Client:     s.Server.Client(),
+	}
+}
+
+// AddProgram adds a program to the server. The program's page is served at
+// its slug.
+func (s *Server) AddProgram(program sr.Program) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	program.ImageURL = s.rewriteImageURL(program.ImageURL)
+	program.ImageTemplateURL = s.rewriteImageURL(program.ImageTemplateURL)
+	program.ImageWideURL = s.rewriteImageURL(program.ImageWideURL)
+	program.ImageTemplateWideURL = s.rewriteImageURL(program.ImageTemplateWideURL)
+	program.SocialImageURL = s.rewriteImageURL(program.SocialImageURL)
+	program.SocialImageTemplateURL = s.rewriteImageURL(program.SocialImageTemplateURL)
+
+	s.programs[program.ID] = program
+}
+
+// AddEpisode adds an episode to the server. The episode's audio files are
+// served as a small, valid m4a file.
+func (s *Server) AddEpisode(episode sr.Episode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	episode.ImageURL = s.rewriteImageURL(episode.ImageURL)
+	episode.ImageURLTemplate = s.rewriteImageURL(episode.ImageURLTemplate)
+
+	if episode.Broadcast != nil {
+		broadcast := *episode.Broadcast
+		broadcast.Files = slices.Clone(broadcast.Files)
+		for i := range broadcast.Files {
+			broadcast.Files[i].URL = s.rewriteAudioURL(broadcast.Files[i].URL)
+		}
+		episode.Broadcast = &broadcast
+	}
+
+	if episode.PodFile != nil {
+		podFile := *episode.PodFile
+		podFile.URL = s.rewriteAudioURL(podFile.URL)
+		episode.PodFile = &podFile
+	}
+
+	s.episodes[episode.ID] = episode
+}
+
+// RemoveEpisode removes an episode from the server.
+func (s *Server) RemoveEpisode(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.episodes, id)
+}
+
+// SetPlaylist sets the playlist of an episode.
+func (s *Server) SetPlaylist(episodeID int, playlist []sr.PlaylistEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.playlists[episodeID] = playlist
+}
+
+// Requests returns the number of requests made to path.
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+// SetBlocked sets whether or not all requests are blocked, like when SR's WAF
+// rejects requests.
+func (s *Server) SetBlocked(blocked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blocked = blocked
+}
+
+// SetFile serves content at path.
+func (s *Server) SetFile(path string, contentType string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[path] = file{ContentType: contentType, Content: content}
+}
+
+func (s *Server) loadFixtures() error {
+	var programs struct {
+		Programs []sr.Program `json:"programs"`
+	}
+	if err := readFixture("fixtures/programs.json", &programs); err != nil {
+		return err
+	}
+
+	var episodes struct {
+		Episodes []sr.Episode `json:"episodes"`
+	}
+	if err := readFixture("fixtures/episodes.json", &episodes); err != nil {
+		return err
+	}
+
+	var playlists struct {
+		Playlists map[int][]sr.PlaylistEntry `json:"playlists"`
+	}
+	if err := readFixture("fixtures/playlists.json", &playlists); err != nil {
+		return err
+	}
+
+	for _, program := range programs.Programs {
+		s.AddProgram(program)
+	}
+
+	for _, episode := range episodes.Episodes {
+		s.AddEpisode(episode)
+	}
+
+	for episodeID, playlist := range playlists.Playlists {
+		s.SetPlaylist(episodeID, playlist)
+	}
+
+	return nil
+}
+
+// rewriteImageURL rewrites u to be served by the server.
+// Expects the lock to be held.
+func (s *Server) rewriteImageURL(u string) string {
+	return s.rewriteURL(u, "fixtures/image.jpg", "image/jpeg")
+}
+
+// rewriteAudioURL rewrites u to be served by the server.
+// Expects the lock to be held.
+func (s *Server) rewriteAudioURL(u string) string {
+	return s.rewriteURL(u, "fixtures/audio.m4a", "audio/mp4")
+}
+
+// rewriteURL rewrites u to point to the server, serving the fixture at path.
+// Expects the lock to be held.
+func (s *Server) rewriteURL(u string, path string, contentType string) string {
+	if u == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+
+	if _, ok := s.files[parsed.Path]; !ok {
+		content, err := fixtures.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+
+		s.files[parsed.Path] = file{ContentType: contentType, Content: content}
+	}
+
+	return s.URL + parsed.RequestURI()
+}
+
+// blockingHandler counts requests and responds with a block page instead of
+// calling next if the server is set to block requests.
+func (s *Server) blockingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		blocked := s.blocked
+		s.mu.Unlock()
+
+		if blocked {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("<html><body>The requested URL was rejected.</body></html>"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleGetProgram(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	program, ok := s.programs[int(id)]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, &struct {
+		Program *sr.Program `json:"program"`
+	}{
+		Program: &program,
+	})
+}
+
+func (s *Server) handleListPrograms(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	page := queryInt(query, "page", 1)
+	size := queryInt(query, "size", 10)
+	if page <= 0 || size <= 0 {
+		http.Error(w, "invalid pagination", http.StatusBadRequest)
+		return
+	}
+
+	channelID := queryInt(query, "channelid", 0)
+	categoryID := queryInt(query, "programcategoryid", 0)
+
+	s.mu.Lock()
+	programs := make([]sr.Program, 0)
+	for _, program := range s.programs {
+		if channelID > 0 && program.Channel.ID != channelID {
+			continue
+		}
+
+		if categoryID > 0 && program.Category.ID != categoryID {
+			continue
+		}
+
+		programs = append(programs, program)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(programs, func(a sr.Program, b sr.Program) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	totalHits := len(programs)
+	start := min((page-1)*size, totalHits)
+	end := min(start+size, totalHits)
+
+	writeJSON(w, &sr.ProgramsPage{
+		Pagination: sr.Pagination{
+			Page:       page,
+			Size:       size,
+			TotalHits:  totalHits,
+			TotalPages: (totalHits + size - 1) / size,
+		},
+		Programs: programs[start:end],
+	})
+}
+
+func (s *Server) handleListEpisodes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	programID, err := strconv.ParseInt(query.Get("programid"), 10, 32)
+	if err != nil {
+		http.Error(w, "invalid program id", http.StatusBadRequest)
+		return
+	}
+
+	page := queryInt(query, "page", 1)
+	size := queryInt(query, "size", 10)
+	if page <= 0 || size <= 0 {
+		http.Error(w, "invalid pagination", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	_, ok := s.programs[int(programID)]
+	episodes := make([]sr.Episode, 0)
+	for _, episode := range s.episodes {
+		if episode.Program.ID == int(programID) {
+			episodes = append(episodes, episode)
+		}
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Newest episodes first, like the real API
+	slices.SortFunc(episodes, func(a sr.Episode, b sr.Episode) int {
+		return b.PublishDate.Compare(a.PublishDate.Time)
+	})
+
+	totalHits := len(episodes)
+	start := min((page-1)*size, totalHits)
+	end := min(start+size, totalHits)
+
+	writeJSON(w, &sr.EpisodesPage{
+		Pagination: sr.Pagination{
+			Page:       page,
+			Size:       size,
+			TotalHits:  totalHits,
+			TotalPages: (totalHits + size - 1) / size,
+		},
+		Episodes: episodes[start:end],
+	})
+}
+
+func (s *Server) handleGetEpisode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	episode, ok := s.episodes[int(id)]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, &struct {
+		Episode *sr.Episode `json:"episode"`
+	}{
+		Episode: &episode,
+	})
+}
+
+func (s *Server) handleGetPlaylist(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	_, ok := s.episodes[int(id)]
+	playlist := s.playlists[int(id)]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if playlist == nil {
+		playlist = make([]sr.PlaylistEntry, 0)
+	}
+
+	writeJSON(w, &struct {
+		Playlist []sr.PlaylistEntry `json:"song"`
+	}{
+		Playlist: playlist,
+	})
+}
+
+// handleFallback serves files and program pages.
+func (s *Server) handleFallback(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	f, isFile := s.files[r.URL.Path]
+	var program *sr.Program
+	for _, p := range s.programs {
+		if p.Slug != "" && p.Slug == strings.Trim(r.URL.Path, "/") {
+			program = &p
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if isFile {
+		w.Header().Set("Content-Type", f.ContentType)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(f.Content))
+		return
+	}
+
+	if program != nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := programPageTemplate.Execute(w, program); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+func readFixture(path string, v any) error {
+	content, err := fixtures.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, v)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func queryInt(query url.Values, key string, fallback int) int {
+	value, err := strconv.ParseInt(query.Get(key), 10, 32)
+	if err != nil {
+		return fallback
+	}
+
+	return int(value)
+}
@@ -0,0 +1,59 @@
+package srtest
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/AlexGustafsson/srdl/internal/httputil"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	client := server.Client()
+
+	programID, err := client.GetProgramID(context.TODO(), server.URL+"/textochmusikmedericschuldt")
+	require.NoError(t, err)
+	assert.Equal(t, 4914, programID)
+
+	program, err := client.GetProgram(context.TODO(), programID)
+	require.NoError(t, err)
+	assert.Equal(t, "Text och musik med Eric Schüldt", program.Name)
+
+	programs, err := client.ListPrograms(context.TODO(), &sr.ListProgramsOptions{ChannelID: 163, PageSize: 1, Page: 2})
+	require.NoError(t, err)
+	assert.Equal(t, sr.Pagination{Page: 2, Size: 1, TotalHits: 2, TotalPages: 2}, programs.Pagination)
+	require.Len(t, programs.Programs, 1)
+	assert.Equal(t, "Text och musik med Eric Schüldt", programs.Programs[0].Name)
+
+	page, err := client.ListEpisodesInProgram(context.TODO(), programID, &sr.ListEpisodesInProgramOptions{PageSize: 1})
+	require.NoError(t, err)
+	assert.Equal(t, sr.Pagination{Page: 1, Size: 1, TotalHits: 2, TotalPages: 2}, page.Pagination)
+	require.Len(t, page.Episodes, 1)
+	assert.Equal(t, 2522448, page.Episodes[0].ID)
+
+	episode, err := client.GetEpisode(context.TODO(), 2479556)
+	require.NoError(t, err)
+	assert.Equal(t, "Detta är skönheten", episode.Title)
+
+	playlist, err := client.GetEpisodePlaylist(context.TODO(), 2479556)
+	require.NoError(t, err)
+	require.Len(t, playlist, 1)
+	assert.Equal(t, "Wolfgang Amadeus Mozart", playlist[0].Composer)
+
+	audio, err := httputil.Download(context.TODO(), episode.Broadcast.Files[0].URL)
+	require.NoError(t, err)
+	defer audio.Close()
+
+	content, err := io.ReadAll(audio)
+	require.NoError(t, err)
+	assert.Equal(t, "ftyp", string(content[4:8]))
+
+	_, err = client.GetProgram(context.TODO(), 1)
+	assert.ErrorIs(t, err, sr.ErrNotFound)
+}
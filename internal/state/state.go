@@ -0,0 +1,125 @@
+// Package state records the SR episodes that have been downloaded.
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/fsutil"
+)
+
+// Store records the episodes that have been downloaded, so that they're not
+// downloaded again, even if their files have been moved or renamed.
+type Store struct {
+	// path is the path to the file the state is persisted to. The state is only
+	// kept in memory unless set.
+	path     string
+	episodes map[int]Entry
+}
+
+// Entry describes a downloaded episode.
+type Entry struct {
+	// Path is the path to the episode's file when it was recorded.
+	Path string `json:"path"`
+	// RecordedAt is when the episode was downloaded or imported.
+	RecordedAt time.Time `json:"recordedAt"`
+	// Imported is whether or not the episode was downloaded by another tool and
+	// imported from an existing archive.
+	Imported bool `json:"imported,omitempty"`
+}
+
+// file is the persisted form of a [Store].
+type file struct {
+	Episodes map[int]Entry `json:"episodes"`
+}
+
+// Open returns a store persisted to path, if set. A missing file results in
+// an empty store.
+func Open(path string) (*Store, error) {
+	store := &Store{
+		path:     path,
+		episodes: make(map[int]Entry),
+	}
+
+	if path == "" {
+		return store, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Unlike caches, invalid state is not silently replaced, as episodes would
+	// be downloaded again
+	var persisted file
+	if err := json.Unmarshal(content, &persisted); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+
+	if persisted.Episodes != nil {
+		store.episodes = persisted.Episodes
+	}
+
+	return store, nil
+}
+
+// Get returns the entry of the episode with the specified id, if it has been
+// recorded.
+func (s *Store) Get(episodeID int) (Entry, bool) {
+	entry, ok := s.episodes[episodeID]
+	return entry, ok
+}
+
+// Find returns the id and entry of the episode recorded with the file at path,
+// if any. Paths are compared as absolute paths.
+func (s *Store) Find(path string) (int, Entry, bool) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, Entry{}, false
+	}
+
+	for episodeID, entry := range s.episodes {
+		if recorded, err := filepath.Abs(entry.Path); err == nil && recorded == path {
+			return episodeID, entry, true
+		}
+	}
+
+	return 0, Entry{}, false
+}
+
+// Record records the episode with the specified id and persists the store.
+func (s *Store) Record(episodeID int, entry Entry) error {
+	s.Set(episodeID, entry)
+	return s.Save()
+}
+
+// Set records the episode with the specified id without persisting the store.
+func (s *Store) Set(episodeID int, entry Entry) {
+	s.episodes[episodeID] = entry
+}
+
+// Save persists the store, if configured to.
+func (s *Store) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(file{Episodes: s.episodes}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(s.path, bytes.NewReader(content), 0644)
+}
@@ -0,0 +1,64 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "state.json")
+
+	// A missing file results in an empty store
+	store, err := Open(path)
+	require.NoError(t, err)
+	_, ok := store.Get(2522448)
+	assert.False(t, ok)
+
+	entry := Entry{
+		Path:       "output/Carpe diem.m4a",
+		RecordedAt: time.Date(2025, 7, 20, 10, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, store.Record(2522448, entry))
+
+	// Recorded episodes are persisted
+	store, err = Open(path)
+	require.NoError(t, err)
+	actual, ok := store.Get(2522448)
+	assert.True(t, ok)
+	assert.Equal(t, entry, actual)
+
+	// Invalid state is not replaced
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+	_, err = Open(path)
+	assert.Error(t, err)
+}
+
+func TestStoreInMemory(t *testing.T) {
+	store, err := Open("")
+	require.NoError(t, err)
+
+	require.NoError(t, store.Record(1, Entry{Path: "file.m4a"}))
+	_, ok := store.Get(1)
+	assert.True(t, ok)
+}
+
+func TestStoreFind(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open("")
+	require.NoError(t, err)
+	require.NoError(t, store.Record(2522448, Entry{Path: filepath.Join(dir, "Carpe diem.m4a")}))
+
+	episodeID, entry, ok := store.Find(filepath.Join(dir, "..", filepath.Base(dir), "Carpe diem.m4a"))
+	assert.True(t, ok)
+	assert.Equal(t, 2522448, episodeID)
+	assert.Equal(t, filepath.Join(dir, "Carpe diem.m4a"), entry.Path)
+
+	_, _, ok = store.Find(filepath.Join(dir, "Okänt avsnitt.m4a"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,132 @@
+// Package tagging maps SR episodes and programs to file metadata.
+package tagging
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/AlexGustafsson/srdl/internal/mp4"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+)
+
+// FreeformMean is the mean of the freeform items identifying the SR episode a
+// file was downloaded from.
+const FreeformMean = "se.sr"
+
+// Names of the freeform items of [Identifiers].
+const (
+	episodeIDName       = "episode_id"
+	programIDName       = "program_id"
+	channelIDName       = "channel_id"
+	broadcastFileIDName = "broadcast_file_id"
+	sourceURLName       = "source_url"
+)
+
+// Identifiers identify the SR episode a file was downloaded from. They are
+// stored as freeform items in the file's metadata.
+type Identifiers struct {
+	EpisodeID int
+	ProgramID int
+	ChannelID int
+	// BroadcastFileID is the id of the broadcast file that was downloaded, if
+	// the episode was downloaded from a broadcast rather than a pod.
+	BroadcastFileID int
+	// SourceURL is the URL the file was downloaded from.
+	SourceURL string
+}
+
+// ReadIdentifiers returns the identifiers stored in metadata. Identifiers
+// that are missing or invalid are left empty.
+func ReadIdentifiers(metadata *mp4.Metadata) Identifiers {
+	readInt := func(name string) int {
+		value, _ := strconv.Atoi(metadata.FreeformValue(FreeformMean, name))
+		return value
+	}
+
+	return Identifiers{
+		EpisodeID:       readInt(episodeIDName),
+		ProgramID:       readInt(programIDName),
+		ChannelID:       readInt(channelIDName),
+		BroadcastFileID: readInt(broadcastFileIDName),
+		SourceURL:       metadata.FreeformValue(FreeformMean, sourceURLName),
+	}
+}
+
+// Write stores the identifiers in metadata, replacing any existing
+// identifiers.
+func (i Identifiers) Write(metadata *mp4.Metadata) {
+	formatInt := func(value int) string {
+		if value == 0 {
+			return ""
+		}
+		return strconv.Itoa(value)
+	}
+
+	metadata.SetFreeform(FreeformMean, episodeIDName, formatInt(i.EpisodeID))
+	metadata.SetFreeform(FreeformMean, programIDName, formatInt(i.ProgramID))
+	metadata.SetFreeform(FreeformMean, channelIDName, formatInt(i.ChannelID))
+	metadata.SetFreeform(FreeformMean, broadcastFileIDName, formatInt(i.BroadcastFileID))
+	metadata.SetFreeform(FreeformMean, sourceURLName, i.SourceURL)
+}
+
+// Metadata returns the metadata of an episode of a program, as written to
+// downloaded MP4 (m4a) files, including the [Identifiers] of the episode. The
+// program is optional, fields that are only known by the program are left
+// empty if it's nil. The source URL is the URL of the downloaded audio file.
+func Metadata(episode *sr.Episode, program *sr.Program, sourceURL string) mp4.Metadata {
+	metadata := mp4.Metadata{
+		Title:           episode.Title,
+		Album:           episode.Program.Name,
+		Description:     episode.Description,
+		LongDescription: episode.Description,
+		Released:        episode.PublishDate.Time,
+		Podcast:         true,
+		PodcastURL:      sr.DefaultClient.ProgramFeedURL(episode.Program.ID),
+		EpisodeGUID:     episode.URL,
+		Show:            episode.Program.Name,
+		EpisodeID:       strconv.Itoa(episode.ID),
+	}
+
+	if metadata.EpisodeGUID == "" {
+		metadata.EpisodeGUID = strconv.Itoa(episode.ID)
+	}
+
+	if program != nil {
+		metadata.AlbumArtist = program.Channel.Name
+		metadata.Genre = program.Category.Name
+		metadata.Category = program.Category.Name
+		metadata.Comment = program.Description
+
+		keywords := make([]string, 0, 2)
+		for _, keyword := range []string{program.Channel.Name, program.Category.Name} {
+			if keyword != "" {
+				keywords = append(keywords, keyword)
+			}
+		}
+		metadata.Keywords = strings.Join(keywords, ",")
+	}
+
+	identifiers := Identifiers{
+		EpisodeID: episode.ID,
+		ProgramID: episode.Program.ID,
+		ChannelID: episode.ChannelID,
+		SourceURL: sourceURL,
+	}
+
+	if program != nil && program.Channel.ID != 0 {
+		identifiers.ChannelID = program.Channel.ID
+	}
+
+	if episode.Broadcast != nil {
+		for _, file := range episode.Broadcast.Files {
+			if file.URL == sourceURL {
+				identifiers.BroadcastFileID = file.ID
+				break
+			}
+		}
+	}
+
+	identifiers.Write(&metadata)
+
+	return metadata
+}
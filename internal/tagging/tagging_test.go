@@ -0,0 +1,90 @@
+package tagging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AlexGustafsson/srdl/internal/mp4"
+	"github.com/AlexGustafsson/srdl/internal/sr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadata(t *testing.T) {
+	episode := &sr.Episode{
+		ID:          2522448,
+		Title:       "Carpe diem",
+		Description: "Fånga dagen!",
+		URL:         "https://www.sverigesradio.se/avsnitt/2522448",
+		Program: sr.ProgramReference{
+			ID:   4914,
+			Name: "Text och musik med Eric Schüldt",
+		},
+		PublishDate: sr.Time{Time: time.Date(2025, 7, 20, 9, 0, 0, 0, time.UTC)},
+		Broadcast: &sr.Broadcast{
+			Files: []sr.BroadcastFile{
+				{
+					ID:  9841912,
+					URL: "https://www.sverigesradio.se/topsy/ljudfil/srapi/9841912.html5desktop",
+				},
+			},
+		},
+		ChannelID: 2562,
+	}
+
+	program := &sr.Program{
+		ID:          4914,
+		Name:        "Text och musik med Eric Schüldt",
+		Description: "En timme med den vackraste musiken.",
+		Category:    sr.ProgramCategory{ID: 5, Name: "Musik"},
+		Channel:     sr.ChannelReference{ID: 163, Name: "P2"},
+	}
+
+	expected := mp4.Metadata{
+		Title:           "Carpe diem",
+		AlbumArtist:     "P2",
+		Album:           "Text och musik med Eric Schüldt",
+		Genre:           "Musik",
+		Comment:         "En timme med den vackraste musiken.",
+		Description:     "Fånga dagen!",
+		LongDescription: "Fånga dagen!",
+		Released:        time.Date(2025, 7, 20, 9, 0, 0, 0, time.UTC),
+		Podcast:         true,
+		PodcastURL:      "https://api.sr.se/api/rss/program/4914",
+		EpisodeGUID:     "https://www.sverigesradio.se/avsnitt/2522448",
+		Category:        "Musik",
+		Keywords:        "P2,Musik",
+		Show:            "Text och musik med Eric Schüldt",
+		EpisodeID:       "2522448",
+		Freeform: []mp4.FreeformItem{
+			{Mean: "se.sr", Name: "episode_id", Value: "2522448"},
+			{Mean: "se.sr", Name: "program_id", Value: "4914"},
+			{Mean: "se.sr", Name: "channel_id", Value: "163"},
+			{Mean: "se.sr", Name: "broadcast_file_id", Value: "9841912"},
+			{Mean: "se.sr", Name: "source_url", Value: "https://www.sverigesradio.se/topsy/ljudfil/srapi/9841912.html5desktop"},
+		},
+	}
+	metadata := Metadata(episode, program, "https://www.sverigesradio.se/topsy/ljudfil/srapi/9841912.html5desktop")
+	assert.Equal(t, expected, metadata)
+
+	assert.Equal(t, Identifiers{
+		EpisodeID:       2522448,
+		ProgramID:       4914,
+		ChannelID:       163,
+		BroadcastFileID: 9841912,
+		SourceURL:       "https://www.sverigesradio.se/topsy/ljudfil/srapi/9841912.html5desktop",
+	}, ReadIdentifiers(&metadata))
+
+	// Without the program
+	expected.AlbumArtist = ""
+	expected.Genre = ""
+	expected.Category = ""
+	expected.Comment = ""
+	expected.Keywords = ""
+	expected.Freeform = []mp4.FreeformItem{
+		{Mean: "se.sr", Name: "episode_id", Value: "2522448"},
+		{Mean: "se.sr", Name: "program_id", Value: "4914"},
+		{Mean: "se.sr", Name: "channel_id", Value: "2562"},
+		{Mean: "se.sr", Name: "source_url", Value: "https://example.com/pod.m4a"},
+	}
+	assert.Equal(t, expected, Metadata(episode, nil, "https://example.com/pod.m4a"))
+}